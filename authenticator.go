@@ -0,0 +1,271 @@
+package networkfile
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Identity identifies the client of an authenticated request
+type Identity string
+
+// IdentitySharedSecret is the identity of clients authenticated by a shared secret, a signed request or a signed URL
+const IdentitySharedSecret Identity = "shared-secret"
+
+// Authenticator authenticates the requests received by a FileServer
+type Authenticator interface {
+	// Authenticate returns the identity of the client of the request, or an error if it is not authenticated
+	Authenticate(req *http.Request) (Identity, error)
+}
+
+// RequestHook is called with every authenticated request before it is handled, for example for auditing or
+// additional authorization. The identity of the client is read from the request context with IdentityFromContext.
+// Returning an error rejects the request with the status code of the error, such as 403 for ErrForbidden.
+type RequestHook func(req *http.Request) error
+
+type identityContextKey struct{}
+
+// IdentityFromContext returns the identity of the client that was authenticated for a request to a FileServer
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityContextKey{}).(Identity)
+	return identity, ok
+}
+
+// secretsEqual compares the secrets in constant time, also hiding their length
+func secretsEqual(given, expected string) bool {
+	givenSum := sha256.Sum256([]byte(given))
+	expectedSum := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(givenSum[:], expectedSum[:]) == 1
+}
+
+// SharedSecretAuthenticator authenticates requests carrying a shared secret in the shared secret header or
+// GET parameter. It accepts multiple secrets at the same time, so a secret can be rotated without downtime.
+type SharedSecretAuthenticator struct {
+	secrets []string
+	mu      sync.RWMutex
+}
+
+// NewSharedSecretAuthenticator creates a new SharedSecretAuthenticator accepting any of the given secrets
+func NewSharedSecretAuthenticator(secrets ...string) *SharedSecretAuthenticator {
+	return &SharedSecretAuthenticator{
+		secrets: secrets,
+	}
+}
+
+// SetSecrets replaces the accepted secrets
+func (a *SharedSecretAuthenticator) SetSecrets(secrets ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.secrets = secrets
+}
+
+// Secrets returns the accepted secrets
+func (a *SharedSecretAuthenticator) Secrets() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]string(nil), a.secrets...)
+}
+
+// Authenticate checks the shared secret of the request
+func (a *SharedSecretAuthenticator) Authenticate(req *http.Request) (Identity, error) {
+	secret := req.Header.Get(HeaderSharedSecret)
+	if secret == "" {
+		secret = req.URL.Query().Get(GETSharedSecret)
+	}
+
+	matched := false
+	for _, expected := range a.Secrets() {
+		// Compare against every secret, so the time taken does not reveal which one matched
+		if secretsEqual(secret, expected) {
+			matched = true
+		}
+	}
+	if !matched {
+		return "", ErrUnauthorized
+	}
+	return IdentitySharedSecret, nil
+}
+
+// BearerTokenAuthenticator authenticates requests carrying a known bearer token in the Authorization header
+type BearerTokenAuthenticator struct {
+	tokens map[[sha256.Size]byte]Identity
+}
+
+// NewBearerTokenAuthenticator creates a new BearerTokenAuthenticator for the given tokens and the identities they belong to
+func NewBearerTokenAuthenticator(tokens map[string]Identity) *BearerTokenAuthenticator {
+	a := &BearerTokenAuthenticator{
+		tokens: make(map[[sha256.Size]byte]Identity, len(tokens)),
+	}
+	for token, identity := range tokens {
+		// Tokens are looked up by their hash, so the lookup time does not reveal anything about them
+		a.tokens[sha256.Sum256([]byte(token))] = identity
+	}
+	return a
+}
+
+// Authenticate looks up the bearer token of the request
+func (a *BearerTokenAuthenticator) Authenticate(req *http.Request) (Identity, error) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", ErrUnauthorized
+	}
+	identity, ok := a.tokens[sha256.Sum256([]byte(token))]
+	if !ok {
+		return "", ErrUnauthorized
+	}
+	return identity, nil
+}
+
+// BasicAuthenticator authenticates requests with HTTP basic authentication, the username is the identity
+type BasicAuthenticator struct {
+	passwords map[string]string
+}
+
+// NewBasicAuthenticator creates a new BasicAuthenticator for the given usernames and their passwords
+func NewBasicAuthenticator(passwords map[string]string) *BasicAuthenticator {
+	return &BasicAuthenticator{
+		passwords: passwords,
+	}
+}
+
+// Authenticate checks the username and password of the request
+func (a *BasicAuthenticator) Authenticate(req *http.Request) (Identity, error) {
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return "", ErrUnauthorized
+	}
+	expected, known := a.passwords[username]
+	// Always compare, so the time taken does not reveal whether the user exists
+	if !secretsEqual(password, expected) || !known {
+		return "", ErrUnauthorized
+	}
+	return Identity(username), nil
+}
+
+// ClientCertAuthenticator authenticates requests by their verified TLS client certificate, the common name of the
+// certificate is the identity. The TLS configuration of the server has to request and verify client certificates.
+type ClientCertAuthenticator struct {
+	allowed map[string]bool
+}
+
+// NewClientCertAuthenticator creates a new ClientCertAuthenticator accepting the given common names, or any
+// verified certificate when none are given
+func NewClientCertAuthenticator(commonNames ...string) *ClientCertAuthenticator {
+	a := &ClientCertAuthenticator{}
+	if len(commonNames) > 0 {
+		a.allowed = make(map[string]bool, len(commonNames))
+		for _, name := range commonNames {
+			a.allowed[name] = true
+		}
+	}
+	return a
+}
+
+// Authenticate checks the verified client certificate of the request
+func (a *ClientCertAuthenticator) Authenticate(req *http.Request) (Identity, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return "", ErrUnauthorized
+	}
+	name := req.TLS.VerifiedChains[0][0].Subject.CommonName
+	if a.allowed != nil && !a.allowed[name] {
+		return "", ErrUnauthorized
+	}
+	return Identity(name), nil
+}
+
+// AnyAuthenticator returns an Authenticator accepting requests accepted by any of the given authenticators,
+// with the identity resolved by the first of them that accepts it
+func AnyAuthenticator(authenticators ...Authenticator) Authenticator {
+	return anyAuthenticator(authenticators)
+}
+
+type anyAuthenticator []Authenticator
+
+// Authenticate tries the authenticators in order
+func (a anyAuthenticator) Authenticate(req *http.Request) (Identity, error) {
+	err := ErrUnauthorized
+	for _, authenticator := range a {
+		var identity Identity
+		identity, err = authenticator.Authenticate(req)
+		if err == nil {
+			return identity, nil
+		}
+	}
+	return "", err
+}
+
+// SetAuthenticator replaces the authenticator, which accepts the shared secrets by default. While at least one
+// non-empty shared secret is set, signed requests and signed URLs are verified with the shared secrets and accepted
+// as IdentitySharedSecret without consulting the authenticator. To only accept the credentials of the authenticator,
+// remove the shared secrets with SetSharedSecrets, after which signatures and signed URLs are ignored and every
+// request is passed to the authenticator.
+func (fs *FileServer) SetAuthenticator(authenticator Authenticator) {
+	fs.authenticator = authenticator
+}
+
+// SetRequestHook sets the hook called with every authenticated request before it is handled
+func (fs *FileServer) SetRequestHook(hook RequestHook) {
+	fs.requestHook = hook
+}
+
+// SetSharedSecrets replaces the accepted shared secrets. The first secret is returned by SharedSecret, all of
+// them are accepted, so clients can move to a new secret before the old one is removed.
+func (fs *FileServer) SetSharedSecrets(secrets ...string) {
+	fs.secrets.SetSecrets(secrets...)
+}
+
+// hasSharedSecret returns whether a non-empty shared secret is set, without which nothing can be signed
+func (fs *FileServer) hasSharedSecret() bool {
+	for _, secret := range fs.secrets.Secrets() {
+		if secret != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate resolves the identity of the client of the request, writing an error response when it is not authenticated
+func (fs *FileServer) authenticate(resp http.ResponseWriter, req *http.Request) (Identity, bool) {
+	token := req.URL.Query().Get(GETSignedToken)
+	signing := fs.hasSharedSecret()
+	switch {
+	case signing && req.Header.Get(HeaderSignature) != "":
+		err := fs.verifyRequestSignature(req)
+		if err != nil {
+			fs.logger.Info("networkfile.FileServer.authenticate: Invalid request signature",
+				"url", req.URL.Path, "method", req.Method, "error", err)
+			switch {
+			case errors.Is(err, errSignedBodyTooLarge):
+				resp.WriteHeader(http.StatusRequestEntityTooLarge)
+			case errors.Is(err, errNonceCacheFull):
+				resp.WriteHeader(http.StatusTooManyRequests)
+			default:
+				resp.WriteHeader(http.StatusUnauthorized)
+			}
+			return "", false
+		}
+		return IdentitySharedSecret, true
+	case signing && req.Header.Get(HeaderSharedSecret) == "" && token != "":
+		return IdentitySharedSecret, fs.checkSignedToken(resp, req, token)
+	}
+
+	// Signing is only required instead of the shared secret, other authentication of the authenticator is unaffected
+	sentSecret := req.Header.Get(HeaderSharedSecret) != "" || req.URL.Query().Has(GETSharedSecret)
+	if (fs.requireSigning && sentSecret) || (!fs.allowSecretInURL && req.URL.Query().Has(GETSharedSecret)) {
+		fs.logger.Debug("networkfile.FileServer.authenticate: Shared secret not accepted", "url", req.URL.Path, "method", req.Method)
+		resp.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+	identity, err := fs.authenticator.Authenticate(req)
+	if err != nil {
+		fs.logger.Debug("networkfile.FileServer.authenticate: Authentication failed",
+			"url", req.URL.Path, "method", req.Method, "error", err)
+		resp.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+	return identity, true
+}
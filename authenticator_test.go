@@ -0,0 +1,221 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedSecretRotation(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), fileID, bytes.NewReader(make([]byte, 100)))
+	assert.NoError(t, err)
+
+	oldRdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	newRdr := NewReader(context.Background(), testServer.URL+prefix, "new-secret", fileID)
+	oldURL, err := oldRdr.SignedReadURL(time.Minute)
+	assert.NoError(t, err)
+
+	// Both secrets are accepted during the rotation
+	srv.SetSharedSecrets("new-secret", secret)
+	assert.Equal(t, "new-secret", srv.SharedSecret())
+	_, err = oldRdr.Stat()
+	assert.NoError(t, err)
+	_, err = newRdr.Stat()
+	assert.NoError(t, err)
+	resp, err := http.Get(oldURL)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	srv.SetSharedSecrets("new-secret")
+	_, err = oldRdr.Stat()
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	_, err = newRdr.Stat()
+	assert.NoError(t, err)
+	resp, err = http.Get(oldURL)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestCustomAuthenticator(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.SetAuthenticator(AnyAuthenticator(
+		NewBearerTokenAuthenticator(map[string]Identity{"token-1": "service-1"}),
+		NewBasicAuthenticator(map[string]string{"alice": "password"}),
+	))
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), fileID, bytes.NewReader(make([]byte, 100)))
+	assert.NoError(t, err)
+
+	stat := func(auth AuthProvider) error {
+		_, err := NewClient(testServer.URL+prefix, WithAuthProvider(auth)).OpenReader(context.Background(), fileID).Stat()
+		return err
+	}
+	assert.NoError(t, stat(BearerTokenAuth("token-1")))
+	assert.NoError(t, stat(BasicAuth{Username: "alice", Password: "password"}))
+	assert.ErrorIs(t, stat(BearerTokenAuth("token-2")), ErrUnauthorized)
+	assert.ErrorIs(t, stat(BasicAuth{Username: "alice", Password: "wrong"}), ErrUnauthorized)
+	assert.ErrorIs(t, stat(BasicAuth{Username: "bob", Password: ""}), ErrUnauthorized)
+	assert.ErrorIs(t, stat(SharedSecretAuth(secret)), ErrUnauthorized)
+
+	// Signed requests are still verified with the shared secret
+	_, err = NewClient(testServer.URL+prefix, WithRequestSigning(secret)).OpenReader(context.Background(), fileID).Stat()
+	assert.NoError(t, err)
+}
+
+func TestAuthenticatorRequireSigning(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.SetAuthenticator(AnyAuthenticator(
+		NewSharedSecretAuthenticator(secret),
+		NewBearerTokenAuthenticator(map[string]Identity{"token-1": "service-1"}),
+	))
+	srv.RequireSignedRequests(true)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), fileID, bytes.NewReader(make([]byte, 100)))
+	assert.NoError(t, err)
+
+	// Only the shared secret has to be replaced by signatures, other credentials are still accepted
+	stat := func(option ClientOption) error {
+		_, err := NewClient(testServer.URL+prefix, option).OpenReader(context.Background(), fileID).Stat()
+		return err
+	}
+	assert.NoError(t, stat(WithAuthProvider(BearerTokenAuth("token-1"))))
+	assert.NoError(t, stat(WithRequestSigning(secret)))
+	assert.ErrorIs(t, stat(WithSharedSecret(secret)), ErrUnauthorized)
+	assert.ErrorIs(t, stat(WithAuthProvider(BearerTokenAuth("token-2"))), ErrUnauthorized)
+}
+
+func TestRequestHook(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.SetAuthenticator(AnyAuthenticator(
+		NewSharedSecretAuthenticator(secret),
+		NewBearerTokenAuthenticator(map[string]Identity{"token-1": "service-1"}),
+	))
+	var mu sync.Mutex
+	var seen []Identity
+	srv.SetRequestHook(func(req *http.Request) error {
+		identity, ok := IdentityFromContext(req.Context())
+		assert.True(t, ok)
+		mu.Lock()
+		seen = append(seen, identity)
+		mu.Unlock()
+		if req.Method == http.MethodDelete {
+			return ErrForbidden
+		}
+		return nil
+	})
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), fileID, bytes.NewReader(make([]byte, 100)))
+	assert.NoError(t, err)
+
+	rdr := NewClient(testServer.URL+prefix, WithAuthProvider(BearerTokenAuth("token-1"))).OpenReader(context.Background(), fileID)
+	_, err = rdr.Stat()
+	assert.NoError(t, err)
+	assert.ErrorIs(t, rdr.Close(), ErrForbidden)
+	_, err = NewReader(context.Background(), testServer.URL+prefix, secret, fileID).Stat()
+	assert.NoError(t, err)
+
+	// Unauthenticated requests never reach the hook
+	_, err = NewReader(context.Background(), testServer.URL+prefix, "wrong", fileID).Stat()
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []Identity{"service-1", "service-1", IdentitySharedSecret}, seen)
+}
+
+func TestAuthenticatorWithoutSharedSecret(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.SetAuthenticator(NewBearerTokenAuthenticator(map[string]Identity{"token-1": "service-1"}))
+	var mu sync.Mutex
+	var seen []Identity
+	srv.SetRequestHook(func(req *http.Request) error {
+		identity, _ := IdentityFromContext(req.Context())
+		mu.Lock()
+		seen = append(seen, identity)
+		mu.Unlock()
+		return nil
+	})
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), fileID, bytes.NewReader(make([]byte, 100)))
+	assert.NoError(t, err)
+	signedURL, err := srv.SignURL(testServer.URL, fileID, time.Minute, http.MethodGet)
+	assert.NoError(t, err)
+
+	// Once the shared secrets are removed, signatures and signed URLs no longer bypass the authenticator
+	srv.SetSharedSecrets()
+	request := func(url string, auth ...AuthProvider) int {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		assert.NoError(t, err)
+		for _, provider := range auth {
+			assert.NoError(t, provider.Authorize(req))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	fileURL := testServer.URL + prefix + "/" + string(fileID)
+	assert.Equal(t, http.StatusUnauthorized, request(fileURL, RequestSigningAuth(secret)))
+	assert.Equal(t, http.StatusUnauthorized, request(fileURL, RequestSigningAuth("")))
+	assert.Equal(t, http.StatusUnauthorized, request(signedURL))
+	assert.Equal(t, http.StatusOK, request(fileURL, BearerTokenAuth("token-1"), RequestSigningAuth("")))
+	assert.Equal(t, http.StatusOK, request(signedURL, BearerTokenAuth("token-1")))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []Identity{"service-1", "service-1"}, seen)
+}
+
+func TestAuthenticatorIdentities(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("alice", "password")
+	identity, err := NewBasicAuthenticator(map[string]string{"alice": "password"}).Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, Identity("alice"), identity)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer token-1")
+	identity, err = NewBearerTokenAuthenticator(map[string]Identity{"token-1": "service-1"}).Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, Identity("service-1"), identity)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	_, err = NewClientCertAuthenticator().Authenticate(req)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "service-2"}}}},
+	}
+	identity, err = NewClientCertAuthenticator().Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, Identity("service-2"), identity)
+	_, err = NewClientCertAuthenticator("service-1").Authenticate(req)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
@@ -0,0 +1,141 @@
+package networkfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DigestAlgorithm is a checksum algorithm used to verify the integrity of transferred chunks
+type DigestAlgorithm string
+
+const (
+	// DigestCRC32C is the CRC-32 checksum with the Castagnoli polynomial
+	DigestCRC32C DigestAlgorithm = "crc32c"
+
+	// DigestSHA256 is the SHA-256 hash
+	DigestSHA256 DigestAlgorithm = "sha-256"
+)
+
+const (
+	// HeaderDigest is the header or trailer carrying the digest of a request or response body
+	HeaderDigest = "X-Digest"
+
+	// HeaderWantDigest is the header used by readers to request a digest of the response body
+	HeaderWantDigest = "X-Want-Digest"
+)
+
+// DefaultMaxVerifiedChunkSize is the default maximum length of a written chunk with a digest, which is
+// held in memory until it is verified
+const DefaultMaxVerifiedChunkSize = 64 * 1024 * 1024
+
+var (
+	// ErrChecksumMismatch is returned when a transferred chunk does not match its digest
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrDigestMissing is returned when the server did not send or verify the digest of a chunk, for example because
+	// it does not allow checksums or a proxy stripped the digest. It matches ErrChecksumMismatch.
+	ErrDigestMissing = fmt.Errorf("%w: digest missing", ErrChecksumMismatch)
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SetMaxVerifiedChunkSize sets the maximum length of a written chunk with a digest, and of the body of a signed
+// request. Both are held in memory until they are verified, longer ones are rejected with 413 Request Entity Too Large.
+func (fs *FileServer) SetMaxVerifiedChunkSize(size int64) {
+	fs.maxVerifiedChunk = size
+}
+
+// newHash returns a new hash for the algorithm, or false if the algorithm is not supported
+func (a DigestAlgorithm) newHash() (hash.Hash, bool) {
+	switch a {
+	case DigestCRC32C:
+		return crc32.New(crc32cTable), true
+	case DigestSHA256:
+		return sha256.New(), true
+	}
+	return nil, false
+}
+
+// formatDigest formats a digest for the digest header
+func formatDigest(algo DigestAlgorithm, sum []byte) string {
+	return fmt.Sprintf("%s=%s", algo, base64.StdEncoding.EncodeToString(sum))
+}
+
+// parseDigest parses the value of a digest header
+func parseDigest(value string) (DigestAlgorithm, []byte, error) {
+	algo, encoded, ok := strings.Cut(value, "=")
+	if !ok {
+		return "", nil, fmt.Errorf("invalid digest %q", value)
+	}
+	sum, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid digest %q: %w", value, err)
+	}
+	return DigestAlgorithm(strings.ToLower(algo)), sum, nil
+}
+
+// verifyDigest checks the data against the value of a digest header
+func verifyDigest(value string, data []byte) error {
+	algo, expected, err := parseDigest(value)
+	if err != nil {
+		return err
+	}
+	h, ok := algo.newHash()
+	if !ok {
+		return ErrUnsupportedOperation
+	}
+	_, _ = h.Write(data)
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// digestReader hashes a response body and verifies it against the digest trailer once the body is exhausted.
+// A response without a digest trailer cannot be verified and fails with ErrDigestMissing.
+type digestReader struct {
+	resp *http.Response
+	body io.Reader
+	algo DigestAlgorithm
+	hash hash.Hash
+}
+
+func newDigestReader(resp *http.Response, body io.Reader, algo DigestAlgorithm) *digestReader {
+	h, _ := algo.newHash()
+	return &digestReader{
+		resp: resp,
+		body: body,
+		algo: algo,
+		hash: h,
+	}
+}
+
+// Read reads from the body and verifies the digest on EOF
+func (d *digestReader) Read(buf []byte) (n int, err error) {
+	n, err = d.body.Read(buf)
+	_, _ = d.hash.Write(buf[:n])
+	if !errors.Is(err, io.EOF) {
+		return n, err
+	}
+
+	value := d.resp.Trailer.Get(HeaderDigest)
+	if value == "" {
+		return n, ErrDigestMissing
+	}
+	algo, expected, parseErr := parseDigest(value)
+	if parseErr != nil {
+		return n, parseErr
+	}
+	if algo != d.algo || !bytes.Equal(d.hash.Sum(nil), expected) {
+		return n, ErrChecksumMismatch
+	}
+	return n, err
+}
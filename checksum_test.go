@@ -0,0 +1,195 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// corruptingResponseWriter flips the bits of the first byte written
+type corruptingResponseWriter struct {
+	http.ResponseWriter
+	corrupted bool
+}
+
+func (c *corruptingResponseWriter) Write(buf []byte) (int, error) {
+	if !c.corrupted && len(buf) > 0 {
+		c.corrupted = true
+		corrupt := append([]byte{}, buf...)
+		corrupt[0] ^= 0xff
+		return c.ResponseWriter.Write(corrupt)
+	}
+	return c.ResponseWriter.Write(buf)
+}
+
+// corruptingServer corrupts the first byte of every ranged GET response and PATCH request body
+func corruptingServer(srv *FileServer) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodGet && req.Header.Get(HeaderRange) != "":
+			resp = &corruptingResponseWriter{ResponseWriter: resp}
+		case req.Method == http.MethodPatch:
+			data, _ := io.ReadAll(req.Body)
+			data[0] ^= 0xff
+			req.Body = io.NopCloser(bytes.NewReader(data))
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+}
+
+func TestReaderChecksum(t *testing.T) {
+	for _, algo := range []DigestAlgorithm{DigestCRC32C, DigestSHA256} {
+		srv := NewFileServer(prefix, secret)
+		testServer := httptest.NewServer(srv)
+		corruptServer := corruptingServer(srv)
+
+		fileID, err := RandomFileID()
+		assert.NoError(t, err)
+		src, err := randomFile(1000)
+		assert.NoError(t, err)
+		srcBuf, err := io.ReadAll(src)
+		assert.NoError(t, err)
+
+		err = srv.ServeFileReader(context.Background(), fileID, src)
+		assert.NoError(t, err)
+
+		rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+		rdr.SetChecksum(algo)
+
+		buf := make([]byte, 600)
+		n, err := rdr.ReadAt(buf, 400)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 600, n)
+		assert.EqualValues(t, srcBuf[400:], buf)
+
+		rdr = NewReader(context.Background(), corruptServer.URL+prefix, secret, fileID)
+		rdr.SetChecksum(algo)
+
+		_, err = rdr.ReadAt(buf, 0)
+		assert.Equal(t, ErrChecksumMismatch, err)
+
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}
+}
+
+func TestWriterChecksum(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+	corruptServer := corruptingServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "writer-checksum-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	wrtr.SetChecksum(DigestSHA256)
+
+	n, err := wrtr.Write([]byte("Hello, World!"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 13, n)
+
+	wrtr = NewWriter(context.Background(), corruptServer.URL+prefix, secret, fileID)
+	wrtr.SetChecksum(DigestCRC32C)
+
+	n, err = wrtr.WriteAt([]byte("Goodbye"), 0)
+	assert.Equal(t, ErrChecksumMismatch, err)
+	assert.EqualValues(t, 0, n)
+
+	_, err = dst.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	dstBuf, err := io.ReadAll(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello, World!", string(dstBuf))
+}
+
+func TestWriterChecksumChunkSize(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.SetMaxVerifiedChunkSize(10)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "writer-checksum-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	// Chunks with a digest are only buffered up to the maximum length
+	req, err := http.NewRequest(http.MethodPatch, testServer.URL+prefix+"/"+string(fileID), bytes.NewBufferString("Hello, World!"))
+	assert.NoError(t, err)
+	req.Header.Set(HeaderSharedSecret, secret)
+	req.Header.Set(HeaderRange, "0-13")
+	req.Header.Set(HeaderDigest, formatDigest(DigestCRC32C, []byte{0, 0, 0, 0}))
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	wrtr.SetChecksum(DigestCRC32C)
+	_, err = wrtr.WriteAt([]byte("Hello, World!"), 0)
+	assert.Error(t, err)
+	n, err := wrtr.WriteAt([]byte("Hello"), 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, n)
+
+	dstBuf, err := os.ReadFile(dst.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", string(dstBuf))
+}
+
+func TestChecksumDigestMissing(t *testing.T) {
+	// A server not sending digests looks the same as a proxy stripping them
+	srv := NewFileServer(prefix, secret)
+	srv.AllowChecksums(false)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "checksum-missing-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFile(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	wrtr.SetChecksum(DigestSHA256)
+	_, err = wrtr.WriteAt([]byte("Hello, World!"), 0)
+	assert.ErrorIs(t, err, ErrDigestMissing)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.SetChecksum(DigestCRC32C)
+	_, err = rdr.ReadAt(make([]byte, 5), 0)
+	assert.ErrorIs(t, err, ErrDigestMissing)
+
+	rdr.SetChecksum("")
+	buf := make([]byte, 5)
+	_, err = rdr.ReadAt(buf, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", string(buf))
+}
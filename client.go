@@ -0,0 +1,194 @@
+package networkfile
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// AuthProvider adds credentials to the requests sent to a FileServer
+type AuthProvider interface {
+	Authorize(req *http.Request) error
+}
+
+// SharedSecretAuth is an AuthProvider sending a shared secret in the shared secret header
+type SharedSecretAuth string
+
+// Authorize sets the shared secret header on the request
+func (s SharedSecretAuth) Authorize(req *http.Request) error {
+	req.Header.Set(HeaderSharedSecret, string(s))
+	return nil
+}
+
+// BearerTokenAuth is an AuthProvider sending a bearer token in the Authorization header
+type BearerTokenAuth string
+
+// Authorize sets the Authorization header on the request
+func (b BearerTokenAuth) Authorize(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(b))
+	return nil
+}
+
+// BasicAuth is an AuthProvider sending a username and password with HTTP basic authentication
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// Authorize sets the basic authentication of the request
+func (b BasicAuth) Authorize(req *http.Request) error {
+	req.SetBasicAuth(b.Username, b.Password)
+	return nil
+}
+
+// Client holds the endpoint, credentials and transport for opening remote files on a FileServer
+type Client struct {
+	httpClient   *http.Client
+	baseURL      string
+	sharedSecret string
+	auth         AuthProvider
+	logger       *slog.Logger
+	retry        *RetryPolicy
+	chunkSize    int
+	digest       DigestAlgorithm
+	compression  bool
+	observer     Observer
+}
+
+// ClientOption configures a Client
+type ClientOption func(c *Client)
+
+// WithSharedSecret authenticates all requests with the given shared secret
+func WithSharedSecret(sharedSecret string) ClientOption {
+	return func(c *Client) {
+		c.sharedSecret = sharedSecret
+		c.auth = SharedSecretAuth(sharedSecret)
+	}
+}
+
+// WithRequestSigning authenticates all requests by signing them with the given shared secret, which is never sent
+func WithRequestSigning(sharedSecret string) ClientOption {
+	return func(c *Client) {
+		c.sharedSecret = sharedSecret
+		c.auth = RequestSigningAuth(sharedSecret)
+	}
+}
+
+// WithAuthProvider authenticates all requests with the given provider instead of a shared secret
+func WithAuthProvider(auth AuthProvider) ClientOption {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all requests, replacing http.DefaultClient
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithLogger sets the structured logger for all opened files, replacing the default slog logger
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry failed requests of all opened files
+func WithRetryPolicy(policy *RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithChunkSize sets the maximum size of a single read or write request, larger reads and writes are split
+func WithChunkSize(chunkSize int) ClientOption {
+	return func(c *Client) {
+		c.chunkSize = chunkSize
+	}
+}
+
+// WithChecksum verifies every transferred chunk with the given digest algorithm
+func WithChecksum(algo DigestAlgorithm) ClientOption {
+	return func(c *Client) {
+		c.digest = algo
+	}
+}
+
+// WithCompression sets whether chunks are transferred gzip compressed
+func WithCompression(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.compression = enabled
+	}
+}
+
+// WithObserver sets the observer receiving callbacks about the requests of all opened files
+func WithObserver(observer Observer) ClientOption {
+	return func(c *Client) {
+		c.observer = observer
+	}
+}
+
+// NewClient creates a new Client for the FileServer at the given URL
+func NewClient(baseURL string, opts ...ClientOption) *Client {
+	c := &Client{
+		httpClient: http.DefaultClient,
+		baseURL:    baseURL,
+		logger:     slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// initFile initialises the base of a remote file handle with the configuration of the client
+func (c *Client) initFile(ctx context.Context, f *file, fileID FileID) {
+	f.client = c.httpClient
+	f.ctx = ctx
+	f.baseURL = c.baseURL
+	f.sharedSecret = c.sharedSecret
+	f.auth = c.auth
+	f.fileID = fileID
+	f.offset = 0
+	f.logger = c.logger
+	f.retry = c.retry
+	f.digest = c.digest
+	f.compression = c.compression
+	f.observer = c.observer
+}
+
+// OpenReader creates a new remote Reader for the given FileID
+func (c *Client) OpenReader(ctx context.Context, fileID FileID) *Reader {
+	r := &Reader{}
+	c.initFile(ctx, &r.file, fileID)
+	if c.chunkSize > 0 {
+		r.SetParallelReads(c.chunkSize, 1)
+	}
+	return r
+}
+
+// OpenWriter creates a new remote Writer for the given FileID
+func (c *Client) OpenWriter(ctx context.Context, fileID FileID) *Writer {
+	w := &Writer{
+		chunkSize: c.chunkSize,
+	}
+	c.initFile(ctx, &w.file, fileID)
+	return w
+}
+
+// Stat returns the information of the remote file with the given FileID
+func (c *Client) Stat(ctx context.Context, fileID FileID) (os.FileInfo, error) {
+	f := &file{}
+	c.initFile(ctx, f, fileID)
+	return f.Stat()
+}
+
+// Close tells the server to close the remote file with the given FileID
+func (c *Client) Close(ctx context.Context, fileID FileID) error {
+	f := &file{}
+	c.initFile(ctx, f, fileID)
+	return f.close()
+}
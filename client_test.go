@@ -0,0 +1,97 @@
+package networkfile
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var patches int64
+	testServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPatch {
+			atomic.AddInt64(&patches, 1)
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "client-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	client := NewClient(testServer.URL+prefix,
+		WithSharedSecret(secret),
+		WithHTTPClient(testServer.Client()),
+		WithRetryPolicy(DefaultRetryPolicy()),
+		WithChecksum(DigestCRC32C),
+		WithChunkSize(1000),
+	)
+
+	src, err := randomFile(4500)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	wrtr := client.OpenWriter(context.Background(), fileID)
+	n, err := wrtr.Write(srcBuf)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4500, n)
+	assert.EqualValues(t, 5, atomic.LoadInt64(&patches))
+
+	fi, err := client.Stat(context.Background(), fileID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4500, fi.Size())
+
+	rdr := client.OpenReader(context.Background(), fileID)
+	buf := make([]byte, 4500)
+	n, err = rdr.ReadAt(buf, 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4500, n)
+	assert.EqualValues(t, srcBuf, buf)
+
+	assert.NoError(t, client.Close(context.Background(), fileID))
+	assert.Equal(t, ErrUnknownFile, client.Close(context.Background(), fileID))
+}
+
+type headerAuth struct {
+	header, value string
+}
+
+func (h headerAuth) Authorize(req *http.Request) error {
+	req.Header.Set(h.header, h.value)
+	return nil
+}
+
+func TestClientAuthProvider(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	client := NewClient(testServer.URL+prefix, WithAuthProvider(headerAuth{header: HeaderSharedSecret, value: secret}))
+	_, err := client.Stat(context.Background(), "unknown")
+	assert.Equal(t, ErrUnknownFile, err)
+
+	client = NewClient(testServer.URL+prefix, WithAuthProvider(headerAuth{header: HeaderSharedSecret, value: "wrong"}))
+	_, err = client.Stat(context.Background(), "unknown")
+	assert.Equal(t, ErrUnauthorized, err)
+}
@@ -0,0 +1,60 @@
+package networkfile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+const (
+	// HeaderAcceptEncoding is the header used to announce which encodings are accepted
+	HeaderAcceptEncoding = "Accept-Encoding"
+
+	// HeaderContentEncoding is the header used to specify the encoding of a body
+	HeaderContentEncoding = "Content-Encoding"
+
+	// EncodingGzip is the gzip content encoding
+	EncodingGzip = "gzip"
+)
+
+// acceptsEncoding returns whether the list of encodings in the header value contains the given encoding
+func acceptsEncoding(value, encoding string) bool {
+	for _, part := range strings.Split(value, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
+
+// compressGzip returns the gzip compressed data
+func compressGzip(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SetCompression sets whether chunks are transferred gzip compressed. Reads are compressed when the server
+// agrees to it, writes are compressed once the server announced it accepts compressed bodies.
+func (f *file) SetCompression(enabled bool) {
+	f.compression = enabled
+}
+
+// learnEncodings records whether the server accepts compressed request bodies
+func (f *file) learnEncodings(resp *http.Response) {
+	if !f.compression {
+		return
+	}
+	f.gzipAccepted.Store(acceptsEncoding(resp.Header.Get(HeaderAcceptEncoding), EncodingGzip))
+}
@@ -0,0 +1,119 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodingRecorder records the content encodings of requests and responses
+type encodingRecorder struct {
+	requests  []string
+	responses []string
+	mu        sync.Mutex
+}
+
+func (e *encodingRecorder) server(srv *FileServer) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		srv.ServeHTTP(resp, req)
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		switch req.Method {
+		case http.MethodGet:
+			e.responses = append(e.responses, resp.Header().Get(HeaderContentEncoding))
+		case http.MethodPatch:
+			e.requests = append(e.requests, req.Header.Get(HeaderContentEncoding))
+		}
+	}))
+}
+
+func TestReaderCompression(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	recorder := &encodingRecorder{}
+	testServer := recorder.server(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := os.CreateTemp(os.TempDir(), "reader-compression-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf := []byte(strings.Repeat(`{"message": "Hello, World!"}`+"\n", 1000))
+	_, err = src.Write(srcBuf)
+	assert.NoError(t, err)
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.SetCompression(true)
+	rdr.SetChecksum(DigestCRC32C)
+
+	dstBuf, err := io.ReadAll(io.NewSectionReader(rdr, 0, int64(len(srcBuf))))
+	assert.NoError(t, err)
+	assert.EqualValues(t, srcBuf, dstBuf)
+	assert.NotEmpty(t, recorder.responses)
+	assert.Equal(t, EncodingGzip, recorder.responses[0])
+
+	srv.AllowCompression(false)
+	buf := make([]byte, 100)
+	n, err := rdr.ReadAt(buf, 10)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 100, n)
+	assert.EqualValues(t, srcBuf[10:110], buf)
+	assert.Equal(t, "", recorder.responses[len(recorder.responses)-1])
+}
+
+func TestWriterCompression(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	recorder := &encodingRecorder{}
+	testServer := recorder.server(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "writer-compression-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	wrtr.SetCompression(true)
+	wrtr.SetChecksum(DigestSHA256)
+
+	line := []byte(strings.Repeat("a log line that compresses well\n", 100))
+	for i := 0; i < 3; i++ {
+		_, err = wrtr.Write(line)
+		assert.NoError(t, err)
+	}
+
+	// The server no longer accepts compressed bodies, the writer should fall back
+	srv.AllowCompression(false)
+	_, err = wrtr.Write(line)
+	assert.NoError(t, err)
+	_, err = wrtr.Write(line)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"", EncodingGzip, EncodingGzip, EncodingGzip, "", ""}, recorder.requests)
+
+	_, err = dst.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	dstBuf, err := io.ReadAll(dst)
+	assert.NoError(t, err)
+	assert.EqualValues(t, bytes.Repeat(line, 5), dstBuf)
+}
@@ -2,16 +2,31 @@ package networkfile
 
 import (
 	"io"
-	"sync"
+	"math"
+	"time"
 )
 
 type concurrentReadSeeker struct {
 	rdr        io.ReadSeeker
-	lastChange *readSeeker
-	mu         sync.Mutex
+	rdrAt      io.ReaderAt // Read with positional reads without locking when set
+	generation uint64
+	registered time.Time
+	policy     *handlePolicy // Overrides the access settings of the server when set
+	lock       *handleLock
+}
+
+// handle returns the served reader
+func (rs *concurrentReadSeeker) handle() interface{} {
+	if rs.rdr != nil {
+		return rs.rdr
+	}
+	return rs.rdrAt
 }
 
 func (rs *concurrentReadSeeker) newReadSeeker() io.ReadSeeker {
+	if rs.rdrAt != nil {
+		return io.NewSectionReader(rs.rdrAt, 0, math.MaxInt64)
+	}
 	return &readSeeker{
 		parent: rs,
 	}
@@ -23,17 +38,17 @@ type readSeeker struct {
 }
 
 func (rs *readSeeker) Read(p []byte) (n int, err error) {
-	rs.parent.mu.Lock()
-	defer rs.parent.mu.Unlock()
+	rs.parent.lock.mu.Lock()
+	defer rs.parent.lock.mu.Unlock()
 
-	if rs.parent.lastChange != rs {
+	if rs.parent.lock.lastChange != rs {
 		n, err := rs.parent.rdr.Seek(rs.offset, io.SeekStart)
 		rs.offset = n
 		if err != nil {
 			return 0, err
 		}
 	}
-	rs.parent.lastChange = rs
+	rs.parent.lock.lastChange = rs
 
 	n, err = rs.parent.rdr.Read(p)
 	rs.offset += int64(n)
@@ -41,10 +56,10 @@ func (rs *readSeeker) Read(p []byte) (n int, err error) {
 }
 
 func (rs *readSeeker) Seek(offset int64, whence int) (int64, error) {
-	rs.parent.mu.Lock()
-	defer rs.parent.mu.Unlock()
+	rs.parent.lock.mu.Lock()
+	defer rs.parent.lock.mu.Unlock()
 
-	rs.parent.lastChange = rs
+	rs.parent.lock.lastChange = rs
 
 	n, err := rs.parent.rdr.Seek(offset, whence)
 	rs.offset = n
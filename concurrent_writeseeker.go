@@ -2,49 +2,112 @@ package networkfile
 
 import (
 	"io"
-	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type concurrentWriteSeeker struct {
 	wrtr       io.WriteSeeker
-	lastChange *writeSeeker
-	mu         sync.Mutex
+	wrtrAt     io.WriterAt // Written with positional writes without locking when set
+	generation uint64
+	changes    atomic.Uint64 // Incremented whenever the writer is modified
+	highWater  atomic.Int64  // Highest offset written, or the size set by the last truncate
+	registered time.Time
+	policy     *handlePolicy // Overrides the access settings of the server when set
+	lock       *handleLock
+}
+
+// wrote records a modification of the writer that ended at the given offset
+func (rs *concurrentWriteSeeker) wrote(end int64) {
+	rs.changes.Add(1)
+	for {
+		highWater := rs.highWater.Load()
+		if end <= highWater || rs.highWater.CompareAndSwap(highWater, end) {
+			return
+		}
+	}
+}
+
+// positionalWriter returns the writer as io.WriterAt when it accepts positional writes. Handles refusing them, such as
+// files opened with O_APPEND, fail an empty positional write and are written by seeking under the lock instead.
+func positionalWriter(wrtr io.Writer) io.WriterAt {
+	wrtrAt, ok := wrtr.(io.WriterAt)
+	if !ok {
+		return nil
+	}
+	_, err := wrtrAt.WriteAt(nil, 0)
+	if err != nil {
+		return nil
+	}
+	return wrtrAt
+}
+
+// handle returns the served writer
+func (rs *concurrentWriteSeeker) handle() interface{} {
+	if rs.wrtr != nil {
+		return rs.wrtr
+	}
+	return rs.wrtrAt
 }
 
 func (rs *concurrentWriteSeeker) newWriteSeeker() io.WriteSeeker {
+	if rs.wrtrAt != nil {
+		return &offsetWriter{
+			OffsetWriter: io.NewOffsetWriter(rs.wrtrAt, 0),
+			parent:       rs,
+		}
+	}
 	return &writeSeeker{
 		parent: rs,
 	}
 }
 
+// offsetWriter writes with positional writes without locking
+type offsetWriter struct {
+	*io.OffsetWriter
+	parent *concurrentWriteSeeker
+}
+
+func (ow *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = ow.OffsetWriter.Write(p)
+	if n > 0 {
+		end, _ := ow.OffsetWriter.Seek(0, io.SeekCurrent)
+		ow.parent.wrote(end)
+	}
+	return n, err
+}
+
 type writeSeeker struct {
 	parent *concurrentWriteSeeker
 	offset int64
 }
 
 func (rs *writeSeeker) Write(p []byte) (n int, err error) {
-	rs.parent.mu.Lock()
-	defer rs.parent.mu.Unlock()
+	rs.parent.lock.mu.Lock()
+	defer rs.parent.lock.mu.Unlock()
 
-	if rs.parent.lastChange != rs {
+	if rs.parent.lock.lastChange != rs {
 		n, err := rs.parent.wrtr.Seek(rs.offset, io.SeekStart)
 		rs.offset = n
 		if err != nil {
 			return 0, err
 		}
 	}
-	rs.parent.lastChange = rs
+	rs.parent.lock.lastChange = rs
 
 	n, err = rs.parent.wrtr.Write(p)
 	rs.offset += int64(n)
+	if n > 0 {
+		rs.parent.wrote(rs.offset)
+	}
 	return n, err
 }
 
 func (rs *writeSeeker) Seek(offset int64, whence int) (int64, error) {
-	rs.parent.mu.Lock()
-	defer rs.parent.mu.Unlock()
+	rs.parent.lock.mu.Lock()
+	defer rs.parent.lock.mu.Unlock()
 
-	rs.parent.lastChange = rs
+	rs.parent.lock.lastChange = rs
 
 	n, err := rs.parent.wrtr.Seek(offset, whence)
 	rs.offset = n
@@ -0,0 +1,115 @@
+package networkfile
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// DownloadOptions configures a resumable download
+type DownloadOptions struct {
+	ChunkSize   int    // Size of the individual read requests, defaults to DefaultTransferChunkSize
+	Parallelism int    // Amount of concurrent read requests, defaults to DefaultTransferParallelism
+	JournalPath string // Location of the sidecar journal, defaults to the file path with a .download-journal suffix
+}
+
+// DownloadTo downloads the remote file of the reader to a local file at the given path, reading chunks in parallel.
+// Completed ranges are recorded in a sidecar journal, so an interrupted download resumes with only the
+// missing ranges when it is called again. A download is only resumed when Stat reports the same version, size and
+// modification time as when it was started, otherwise it starts over. The journal is removed once the download completes.
+func DownloadTo(ctx context.Context, rdr *Reader, path string, opts DownloadOptions) error {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultTransferChunkSize
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = DefaultTransferParallelism
+	}
+	if opts.JournalPath == "" {
+		opts.JournalPath = path + ".download-journal"
+	}
+
+	remote, err := rdr.file.stat()
+	if err != nil {
+		return err
+	}
+
+	journal, err := loadJournal(opts.JournalPath)
+	if err != nil {
+		rdr.logger.Info("networkfile.DownloadTo: Ignoring unreadable journal", "path", opts.JournalPath, "error", err)
+	}
+	version := rdr.statETag()
+	resume := journal != nil && journal.matches(rdr.fileID, remote.FileSize, remote.FileModTime, opts.ChunkSize) &&
+		journal.Version == version
+	if !resume {
+		journal = &transferJournal{
+			FileID:    rdr.fileID,
+			Version:   version,
+			Size:      remote.FileSize,
+			ModTime:   remote.FileModTime,
+			ChunkSize: opts.ChunkSize,
+		}
+	}
+
+	dst, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600) // nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dst.Close()
+	}()
+
+	if !resume {
+		// Start from an empty sparse file of the right size
+		err = dst.Truncate(0)
+		if err == nil {
+			err = dst.Truncate(remote.FileSize)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if rdr.ctx != nil {
+		// Read requests end with either the context of the download or that of the reader
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		defer context.AfterFunc(rdr.ctx, cancel)()
+	}
+
+	chunks := journal.Done.missing(0, journal.Size).split(int64(opts.ChunkSize))
+	rdr.logger.Debug("networkfile.DownloadTo: Downloading chunks",
+		"fileID", rdr.fileID, "path", path, "chunks", len(chunks), "resume", resume)
+
+	err = transferChunks(ctx, chunks, opts.Parallelism, func(ctx context.Context, chunk byteRange) error {
+		buf := make([]byte, chunk.End-chunk.Start)
+		n, err := rdr.read(ctx, buf, chunk.Start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if n < len(buf) {
+			return io.ErrUnexpectedEOF
+		}
+		_, err = dst.WriteAt(buf, chunk.Start)
+		return err
+	}, func(chunk byteRange) error {
+		// Make sure the data is on disk before the journal claims it is
+		err := dst.Sync()
+		if err != nil {
+			return err
+		}
+		journal.Done.add(chunk.Start, chunk.End)
+		return journal.save(opts.JournalPath)
+	})
+	if err != nil {
+		rdr.logger.Info("networkfile.DownloadTo: Download interrupted", "fileID", rdr.fileID, "path", path, "error", err)
+		return err
+	}
+
+	err = os.Remove(opts.JournalPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package networkfile
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadToResume(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var reads int64
+	var failAfter int64 = 4
+	testServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet && atomic.AddInt64(&reads, 1) > atomic.LoadInt64(&failAfter) {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(25_000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "download")
+	opts := DownloadOptions{
+		ChunkSize:   2000,
+		Parallelism: 1,
+	}
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+
+	err = DownloadTo(context.Background(), rdr, path, opts)
+	assert.Error(t, err)
+	assert.FileExists(t, path+".download-journal")
+
+	atomic.StoreInt64(&reads, 0)
+	atomic.StoreInt64(&failAfter, 100)
+
+	err = DownloadTo(context.Background(), rdr, path, opts)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, path+".download-journal")
+	assert.EqualValues(t, 9, atomic.LoadInt64(&reads))
+
+	dstBuf, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.EqualValues(t, srcBuf, dstBuf)
+}
+
+func TestDownloadToRemoteChanged(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(5000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	// A stale journal and local file from an earlier version of the remote file
+	path := filepath.Join(t.TempDir(), "download")
+	assert.NoError(t, os.WriteFile(path, make([]byte, 4000), 0o600))
+	journal := &transferJournal{
+		Size:      4000,
+		ChunkSize: 1000,
+	}
+	journal.Done.add(0, 4000)
+	assert.NoError(t, journal.save(path+".download-journal"))
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	err = DownloadTo(context.Background(), rdr, path, DownloadOptions{ChunkSize: 1000})
+	assert.NoError(t, err)
+
+	dstBuf, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.EqualValues(t, srcBuf, dstBuf)
+}
+
+func TestDownloadToCancel(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	reading := make(chan struct{}, 10)
+	testServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			// Hold reads until the client gives up on them
+			reading <- struct{}{}
+			<-req.Context().Done()
+			return
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+	defer testServer.Close()
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(10_000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-reading
+		cancel()
+	}()
+
+	path := filepath.Join(t.TempDir(), "download")
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	err = DownloadTo(ctx, rdr, path, DownloadOptions{ChunkSize: 1000, Parallelism: 4})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -9,6 +9,8 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
 )
 
 // file is the base file for the remote file handles
@@ -17,9 +19,19 @@ type file struct {
 	ctx          context.Context
 	baseURL      string
 	sharedSecret string
+	auth         AuthProvider
 	fileID       FileID
 	offset       int64
 	logger       *slog.Logger
+	retry        *RetryPolicy
+	digest       DigestAlgorithm   // Algorithm used to verify transferred chunks, empty to disable
+	compression  bool              // Whether to transfer chunks compressed
+	gzipAccepted atomic.Bool       // Whether the server announced it accepts gzip compressed bodies
+	onStat       func(fi FileInfo) // Called whenever remote file information was retrieved
+	observer     Observer
+	statVersion  string   // Version of the cached file information, revalidated on the next stat
+	statInfo     FileInfo // Cached file information
+	statMu       sync.Mutex
 }
 
 // SetLogger sets a new structured logger, replacing the default slog logger
@@ -27,6 +39,13 @@ func (f *file) SetLogger(logger *slog.Logger) {
 	f.logger = logger
 }
 
+// SetChecksum enables verification of every transferred chunk with the given digest algorithm.
+// Chunks that do not match their digest result in ErrChecksumMismatch, chunks the server sent or accepted without
+// a digest result in ErrDigestMissing. An empty algorithm disables verification.
+func (f *file) SetChecksum(algo DigestAlgorithm) {
+	f.digest = algo
+}
+
 // Seek seeks to the given offset from the given mode
 func (f *file) Seek(offset int64, whence int) (int64, error) {
 	switch whence {
@@ -72,23 +91,40 @@ func (f *file) Close() error {
 
 // prepareRequest prepares a new HTTP request
 func (f *file) prepareRequest(method, url string, body io.Reader) (*http.Request, error) {
+	return f.prepareRequestContext(f.ctx, method, url, body)
+}
+
+// prepareRequestContext prepares a new HTTP request bound to the given context instead of the context of the file
+func (f *file) prepareRequestContext(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
 	var req *http.Request
 	var err error
-	if f.ctx == nil {
+	if ctx == nil {
 		req, err = http.NewRequest(method, url, body)
 	} else {
-		req, err = http.NewRequestWithContext(f.ctx, method, url, body)
+		req, err = http.NewRequestWithContext(ctx, method, url, body)
 	}
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set(HeaderSharedSecret, f.sharedSecret)
 	return req, nil
 }
 
+// authorize adds the credentials to the request. It is called before every attempt to send the request,
+// so signed requests are signed again when they are retried.
+func (f *file) authorize(req *http.Request) error {
+	if f.auth != nil {
+		return f.auth.Authorize(req)
+	}
+	req.Header.Set(HeaderSharedSecret, f.sharedSecret)
+	return nil
+}
+
 // stat returns the remote file information
-func (f *file) stat() (FileInfo, error) {
-	fi := FileInfo{}
+func (f *file) stat() (fi FileInfo, err error) {
+	done := f.observe(OperationStat)
+	defer func() {
+		done(0, err)
+	}()
 
 	url := fmt.Sprintf("%s/%s", f.baseURL, f.fileID)
 	req, err := f.prepareRequest(http.MethodOptions, url, nil) // nolint:noctx
@@ -96,8 +132,14 @@ func (f *file) stat() (FileInfo, error) {
 		f.logger.Error("networkfile.File.stat: Error creating request", "fileID", f.fileID, "error", err)
 		return fi, err
 	}
+	f.statMu.Lock()
+	cachedVersion, cachedInfo := f.statVersion, f.statInfo
+	f.statMu.Unlock()
+	if cachedVersion != "" {
+		req.Header.Set(HeaderIfNoneMatch, cachedVersion)
+	}
 
-	resp, err := f.client.Do(req)
+	resp, err := f.do(OperationStat, req)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
 			f.logger.Info("networkfile.File.stat: Context expired", "fileID", f.fileID, "error", err)
@@ -110,25 +152,50 @@ func (f *file) stat() (FileInfo, error) {
 		_ = resp.Body.Close()
 	}()
 
-	err = responseCodeToError(resp, http.StatusOK)
-	if err != nil {
-		f.logger.Info("networkfile.File.stat: A remote error occurred", "fileID", f.fileID, "error", err)
-		return fi, err
+	if cachedVersion != "" && resp.StatusCode == http.StatusNotModified {
+		f.logger.Debug("networkfile.File.stat: File info not modified", "fileID", f.fileID, "version", cachedVersion)
+		fi = cachedInfo
+	} else {
+		err = responseCodeToError(resp, http.StatusOK)
+		if err != nil {
+			f.logger.Info("networkfile.File.stat: A remote error occurred", "fileID", f.fileID, "error", err)
+			return fi, err
+		}
+
+		decoder := json.NewDecoder(resp.Body)
+		err = decoder.Decode(&fi)
+		if err != nil {
+			f.logger.Error("networkfile.File.stat: Error decoding file info", "fileID", f.fileID, "error", err)
+			return fi, err
+		}
+
+		f.statMu.Lock()
+		f.statVersion, f.statInfo = resp.Header.Get(HeaderETag), fi
+		f.statMu.Unlock()
 	}
 
-	decoder := json.NewDecoder(resp.Body)
-	err = decoder.Decode(&fi)
-	if err != nil {
-		f.logger.Error("networkfile.File.stat: Error decoding file info", "fileID", f.fileID, "error", err)
-		return fi, err
+	if f.onStat != nil {
+		f.onStat(fi)
 	}
 
 	f.logger.Debug("networkfile.File.stat: File info", "fileID", f.fileID, "fileInfo", fi)
 	return fi, nil
 }
 
+// statETag returns the version the server reported with the last stat, or an empty string if it is unknown
+func (f *file) statETag() string {
+	f.statMu.Lock()
+	defer f.statMu.Unlock()
+	return f.statVersion
+}
+
 // close tells the remote server to close the file
-func (f *file) close() error {
+func (f *file) close() (err error) {
+	done := f.observe(OperationClose)
+	defer func() {
+		done(0, err)
+	}()
+
 	url := fmt.Sprintf("%s/%s", f.baseURL, f.fileID)
 	req, err := f.prepareRequest(http.MethodDelete, url, nil) //nolint: noctx
 	if err != nil {
@@ -136,7 +203,7 @@ func (f *file) close() error {
 		return err
 	}
 
-	resp, err := f.client.Do(req)
+	resp, err := f.do(OperationClose, req)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
 			f.logger.Info("networkfile.File.close: Context expired", "fileID", f.fileID, "error", err)
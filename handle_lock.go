@@ -0,0 +1,42 @@
+package networkfile
+
+import (
+	"slices"
+	"sync"
+)
+
+// handleLock serializes access to a served handle, it is shared by the reader and writer of a handle served with ServeFile
+type handleLock struct {
+	mu         sync.Mutex
+	lastChange interface{} // The read or write seeker that positioned the handle last
+	shared     bool        // Whether the handle is served as both reader and writer by ServeFile
+	rangesMu   sync.Mutex
+	rangeFreed *sync.Cond  // Signalled whenever a locked range is released
+	writing    []byteRange // Ranges locked by positional writes in progress
+}
+
+// lockRange waits until no other positional write overlaps the range, then locks it
+func (l *handleLock) lockRange(start, end int64) {
+	l.rangesMu.Lock()
+	defer l.rangesMu.Unlock()
+
+	if l.rangeFreed == nil {
+		l.rangeFreed = sync.NewCond(&l.rangesMu)
+	}
+	for slices.ContainsFunc(l.writing, func(r byteRange) bool { return r.Start < end && start < r.End }) {
+		l.rangeFreed.Wait()
+	}
+	l.writing = append(l.writing, byteRange{Start: start, End: end})
+}
+
+// unlockRange releases a range locked by lockRange
+func (l *handleLock) unlockRange(start, end int64) {
+	l.rangesMu.Lock()
+	defer l.rangesMu.Unlock()
+
+	index := slices.Index(l.writing, byteRange{Start: start, End: end})
+	if index >= 0 {
+		l.writing = slices.Delete(l.writing, index, index+1)
+	}
+	l.rangeFreed.Broadcast()
+}
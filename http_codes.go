@@ -16,6 +16,7 @@ const (
 	HTTPCodeNoProgress           = 486
 	HTTPCodeUnknownError         = 490
 	HTTPCodeUnsupportedOperation = 491
+	HTTPCodeChecksumMismatch     = 492
 )
 
 var (
@@ -24,20 +25,25 @@ var (
 	ErrUnknownFile          = errors.New("not found: unknown file")
 
 	HTTPCodeToErr = map[int]error{
-		http.StatusUnauthorized:      ErrUnauthorized,
-		http.StatusNotFound:          ErrUnknownFile,
-		HTTPCodeEOF:                  io.EOF,
-		HTTPCodeUnexpectedEOF:        io.ErrUnexpectedEOF,
-		HTTPCodeShortBuffer:          io.ErrShortBuffer,
-		HTTPCodeShortWrite:           io.ErrShortWrite,
-		HTTPCodeClosedPipe:           io.ErrClosedPipe,
-		HTTPCodeNoProgress:           io.ErrNoProgress,
-		HTTPCodeUnsupportedOperation: ErrUnsupportedOperation,
+		http.StatusUnauthorized:       ErrUnauthorized,
+		http.StatusForbidden:          ErrForbidden,
+		http.StatusNotFound:           ErrUnknownFile,
+		http.StatusPreconditionFailed: ErrFileChanged,
+		HTTPCodeEOF:                   io.EOF,
+		HTTPCodeUnexpectedEOF:         io.ErrUnexpectedEOF,
+		HTTPCodeShortBuffer:           io.ErrShortBuffer,
+		HTTPCodeShortWrite:            io.ErrShortWrite,
+		HTTPCodeClosedPipe:            io.ErrClosedPipe,
+		HTTPCodeNoProgress:            io.ErrNoProgress,
+		HTTPCodeUnsupportedOperation:  ErrUnsupportedOperation,
+		HTTPCodeChecksumMismatch:      ErrChecksumMismatch,
 	}
 
 	errToHTTPCode = map[error]int{
 		ErrUnauthorized:         http.StatusUnauthorized,
+		ErrForbidden:            http.StatusForbidden,
 		ErrUnknownFile:          http.StatusNotFound,
+		ErrFileChanged:          http.StatusPreconditionFailed,
 		io.EOF:                  HTTPCodeEOF,
 		io.ErrUnexpectedEOF:     HTTPCodeUnexpectedEOF,
 		io.ErrShortBuffer:       HTTPCodeShortBuffer,
@@ -45,6 +51,7 @@ var (
 		io.ErrClosedPipe:        HTTPCodeClosedPipe,
 		io.ErrNoProgress:        HTTPCodeNoProgress,
 		ErrUnsupportedOperation: HTTPCodeUnsupportedOperation,
+		ErrChecksumMismatch:     HTTPCodeChecksumMismatch,
 	}
 )
 
@@ -0,0 +1,151 @@
+package networkfile
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNamespaceTaken = errors.New("namespace prefix overlaps an existing namespace")
+	ErrTooManyFiles   = errors.New("too many files served")
+)
+
+// Limits limits the resources a FileServer uses, so a single namespace of a NamespaceMux cannot exhaust those
+// shared with other namespaces. Zero values are unlimited.
+type Limits struct {
+	MaxFiles              int // Maximum amount of FileIDs served at the same time, serving more returns ErrTooManyFiles
+	MaxConcurrentRequests int // Maximum amount of requests handled at the same time, others get 429 Too Many Requests
+}
+
+// NamespaceMux serves isolated namespaces from a single http.Handler. Every namespace is a FileServer with its
+// own URL prefix, secrets, authenticator, settings, limits and files. Requests are routed to the namespace by their URL
+// prefix, and prefixes never overlap, so a FileID is only ever served by a single namespace. Signed URLs and signed
+// requests cover the URL prefix, so namespaces sharing a secret do not accept those of each other.
+type NamespaceMux struct {
+	namespaces map[string]*FileServer
+	mu         sync.RWMutex
+	logger     *slog.Logger
+}
+
+// NewNamespaceMux creates a new NamespaceMux without namespaces
+func NewNamespaceMux() *NamespaceMux {
+	return &NamespaceMux{
+		namespaces: make(map[string]*FileServer),
+		logger:     slog.Default(),
+	}
+}
+
+// SetLogger sets a new structured logger, replacing the default slog logger. Namespaces added afterwards use it too.
+func (m *NamespaceMux) SetLogger(logger *slog.Logger) {
+	m.logger = logger
+}
+
+// AddNamespace creates the FileServer of a new namespace for the given URL prefix and shared secret
+func (m *NamespaceMux) AddNamespace(urlPrefix, sharedSecret string) (*FileServer, error) {
+	urlPrefix = strings.TrimSuffix(urlPrefix, "/")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for prefix := range m.namespaces {
+		if prefixesOverlap(prefix, urlPrefix) {
+			return nil, ErrNamespaceTaken
+		}
+	}
+
+	fs := NewFileServer(urlPrefix, sharedSecret)
+	fs.SetLogger(m.logger)
+	m.namespaces[urlPrefix] = fs
+	return fs, nil
+}
+
+// Namespace returns the FileServer of the namespace with the given URL prefix, or nil if there is none
+func (m *NamespaceMux) Namespace(urlPrefix string) *FileServer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.namespaces[strings.TrimSuffix(urlPrefix, "/")]
+}
+
+// RemoveNamespace stops routing requests to the namespace with the given URL prefix.
+// Its files stay registered with its FileServer until their contexts expire.
+func (m *NamespaceMux) RemoveNamespace(urlPrefix string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.namespaces, strings.TrimSuffix(urlPrefix, "/"))
+}
+
+// ServeHTTP routes the request to the namespace of its URL prefix
+func (m *NamespaceMux) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	fs := m.route(req.URL.Path)
+	if fs == nil {
+		m.logger.Debug("networkfile.NamespaceMux.ServeHTTP: Unknown namespace", "url", req.URL.Path)
+		resp.WriteHeader(http.StatusNotFound)
+		return
+	}
+	fs.ServeHTTP(resp, req)
+}
+
+// route returns the FileServer of the namespace the path belongs to
+func (m *NamespaceMux) route(path string) *FileServer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for prefix, fs := range m.namespaces {
+		if strings.HasPrefix(path, prefix+"/") {
+			return fs
+		}
+	}
+	return nil
+}
+
+// SetLimits sets the limits of the server. It should be called before the server is used.
+func (fs *FileServer) SetLimits(limits Limits) {
+	fs.limits = limits
+	fs.requestSlots = nil
+	if limits.MaxConcurrentRequests > 0 {
+		fs.requestSlots = make(chan struct{}, limits.MaxConcurrentRequests)
+	}
+}
+
+// withinFileLimit returns whether the server stays within its file limit when it also serves the given distinct
+// FileIDs, assumes the lock is held
+func (fs *FileServer) withinFileLimit(fileIDs ...FileID) bool {
+	if fs.limits.MaxFiles <= 0 {
+		return true
+	}
+
+	// A FileID served as both reader and writer counts once
+	served := fs.servedFiles
+	for _, fileID := range fileIDs {
+		if !fs.serves(fileID) {
+			served++
+		}
+	}
+	return served <= fs.limits.MaxFiles
+}
+
+// serves returns whether the FileID is served as reader, writer or file of a served fs.FS, assumes the lock is held
+func (fs *FileServer) serves(fileID FileID) bool {
+	return fs.readers[fileID] != nil || fs.writers[fileID] != nil || fs.fsFiles[fileID] != nil
+}
+
+// addServed counts the FileID as served before it is added, assumes a full lock is held
+func (fs *FileServer) addServed(fileID FileID) {
+	if !fs.serves(fileID) {
+		fs.servedFiles++
+	}
+}
+
+// removeServed stops counting the FileID as served after it was removed, assumes a full lock is held
+func (fs *FileServer) removeServed(fileID FileID) {
+	if !fs.serves(fileID) {
+		fs.servedFiles--
+		fs.forgetVersion(fileID)
+	}
+}
+
+// prefixesOverlap returns whether a path could belong to both URL prefixes
+func prefixesOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
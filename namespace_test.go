@@ -0,0 +1,189 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceMux(t *testing.T) {
+	mux := NewNamespaceMux()
+	testServer := httptest.NewServer(mux)
+
+	tenant1, err := mux.AddNamespace("/tenant-1", "secret-1")
+	assert.NoError(t, err)
+	tenant2, err := mux.AddNamespace("/tenant-2/", "secret-2")
+	assert.NoError(t, err)
+	assert.Equal(t, tenant2, mux.Namespace("/tenant-2"))
+
+	_, err = mux.AddNamespace("/tenant-1/sub", "secret-3")
+	assert.ErrorIs(t, err, ErrNamespaceTaken)
+	_, err = mux.AddNamespace("", "secret-3")
+	assert.ErrorIs(t, err, ErrNamespaceTaken)
+
+	// The same FileID is served independently by both tenants
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = tenant1.ServeFileReader(context.Background(), fileID, bytes.NewReader([]byte("one")))
+	assert.NoError(t, err)
+	err = tenant2.ServeFileReader(context.Background(), fileID, bytes.NewReader([]byte("two")))
+	assert.NoError(t, err)
+
+	buf := make([]byte, 3)
+	_, err = NewReader(context.Background(), testServer.URL+"/tenant-1", "secret-1", fileID).ReadAt(buf, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "one", string(buf))
+	_, err = NewReader(context.Background(), testServer.URL+"/tenant-2", "secret-2", fileID).ReadAt(buf, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "two", string(buf))
+
+	// Secrets of one tenant are not accepted by another
+	_, err = NewReader(context.Background(), testServer.URL+"/tenant-2", "secret-1", fileID).ReadAt(buf, 0)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	_, err = NewReader(context.Background(), testServer.URL+"/tenant-3", "secret-1", fileID).ReadAt(buf, 0)
+	assert.ErrorIs(t, err, ErrUnknownFile)
+
+	mux.RemoveNamespace("/tenant-1")
+	assert.Nil(t, mux.Namespace("/tenant-1"))
+	_, err = NewReader(context.Background(), testServer.URL+"/tenant-1", "secret-1", fileID).ReadAt(buf, 0)
+	assert.ErrorIs(t, err, ErrUnknownFile)
+}
+
+func TestNamespaceMuxSignedURLs(t *testing.T) {
+	mux := NewNamespaceMux()
+	testServer := httptest.NewServer(mux)
+
+	// Even tenants sharing a secret do not accept the signed URLs and requests of each other
+	tenant1, err := mux.AddNamespace("/tenant-1", "secret")
+	assert.NoError(t, err)
+	tenant2, err := mux.AddNamespace("/tenant-2", "secret")
+	assert.NoError(t, err)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = tenant1.ServeFileReader(context.Background(), fileID, bytes.NewReader([]byte("one")))
+	assert.NoError(t, err)
+	err = tenant2.ServeFileReader(context.Background(), fileID, bytes.NewReader([]byte("two")))
+	assert.NoError(t, err)
+
+	get := func(url string, sign bool) int {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		assert.NoError(t, err)
+		if sign {
+			req.Header.Set(HeaderRange, "0-3")
+			assert.NoError(t, RequestSigningAuth("secret").Authorize(req))
+			req.URL.Path = strings.Replace(req.URL.Path, "/tenant-1/", "/tenant-2/", 1)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	url, err := NewReader(context.Background(), testServer.URL+"/tenant-1", "secret", fileID).SignedReadURL(time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get(url, false))
+	assert.Equal(t, http.StatusForbidden, get(strings.Replace(url, "/tenant-1/", "/tenant-2/", 1), false))
+
+	url, err = tenant1.SignURL(testServer.URL, fileID, time.Minute, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get(url, false))
+	assert.Equal(t, http.StatusForbidden, get(strings.Replace(url, "/tenant-1/", "/tenant-2/", 1), false))
+
+	assert.Equal(t, http.StatusUnauthorized, get(testServer.URL+"/tenant-1/"+string(fileID), true))
+}
+
+// blockingReaderAt blocks every read until it is released
+type blockingReaderAt struct {
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingReaderAt) ReadAt(buf []byte, offset int64) (int, error) {
+	r.reading <- struct{}{}
+	<-r.release
+	return copy(buf, "data"[offset:]), nil
+}
+
+func TestNamespaceMuxLimits(t *testing.T) {
+	mux := NewNamespaceMux()
+	testServer := httptest.NewServer(mux)
+
+	tenant1, err := mux.AddNamespace("/tenant-1", "secret-1")
+	assert.NoError(t, err)
+	tenant2, err := mux.AddNamespace("/tenant-2", "secret-2")
+	assert.NoError(t, err)
+	tenant1.SetLimits(Limits{MaxFiles: 2, MaxConcurrentRequests: 1})
+
+	// A FileID served as both reader and writer counts once
+	fileIDs := make([]FileID, 3)
+	for i := range fileIDs {
+		fileIDs[i], err = RandomFileID()
+		assert.NoError(t, err)
+	}
+	blocking := &blockingReaderAt{
+		reading: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	err = tenant1.ServeFileReaderAt(context.Background(), fileIDs[0], blocking)
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "namespace-dst-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+	err = tenant1.ServeFileWriter(context.Background(), fileIDs[0], dst)
+	assert.NoError(t, err)
+	err = tenant1.ServeFileReader(context.Background(), fileIDs[1], bytes.NewReader([]byte("data")))
+	assert.NoError(t, err)
+	err = tenant1.ServeFileReader(context.Background(), fileIDs[2], bytes.NewReader([]byte("data")))
+	assert.ErrorIs(t, err, ErrTooManyFiles)
+
+	// Other namespaces are not limited
+	for _, fileID := range fileIDs {
+		err = tenant2.ServeFileReader(context.Background(), fileID, bytes.NewReader([]byte("data")))
+		assert.NoError(t, err)
+	}
+
+	request := func(method, namespace, secret string, fileID FileID) int {
+		req, err := http.NewRequest(method, testServer.URL+namespace+"/"+string(fileID), nil)
+		assert.NoError(t, err)
+		req.Header.Set(HeaderSharedSecret, secret)
+		req.Header.Set(HeaderRange, "0-4")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// While a request is in progress, further requests of the namespace are rejected
+	blocked := make(chan int)
+	go func() {
+		blocked <- request(http.MethodGet, "/tenant-1", "secret-1", fileIDs[0])
+	}()
+	<-blocking.reading
+	assert.Equal(t, http.StatusTooManyRequests, request(http.MethodGet, "/tenant-1", "secret-1", fileIDs[1]))
+	// Requests are authenticated before they take a slot, so unauthenticated requests never hold one
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/tenant-1", "wrong", fileIDs[1]))
+	assert.Equal(t, http.StatusPartialContent, request(http.MethodGet, "/tenant-2", "secret-2", fileIDs[1]))
+
+	close(blocking.release)
+	assert.Equal(t, http.StatusPartialContent, <-blocked)
+	assert.Equal(t, http.StatusPartialContent, request(http.MethodGet, "/tenant-1", "secret-1", fileIDs[1]))
+
+	// Closed files no longer count towards the limit
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, "/tenant-1", "secret-1", fileIDs[1]))
+	err = tenant1.ServeFileReader(context.Background(), fileIDs[2], bytes.NewReader([]byte("data")))
+	assert.NoError(t, err)
+	err = tenant1.ServeFileReader(context.Background(), fileIDs[1], bytes.NewReader([]byte("data")))
+	assert.ErrorIs(t, err, ErrTooManyFiles)
+}
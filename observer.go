@@ -0,0 +1,182 @@
+package networkfile
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Observer receives callbacks about the requests made by remote files, for example to collect metrics.
+// Callbacks can be called concurrently and should return quickly.
+type Observer interface {
+	// RequestStarted is called when an operation starts
+	RequestStarted(op Operation, fileID FileID)
+	// RequestRetried is called when an attempt of an operation failed and is retried
+	RequestRetried(op Operation, fileID FileID, attempt int, err error)
+	// BytesTransferred is called with the amount of file data an operation read or wrote
+	BytesTransferred(op Operation, fileID FileID, n int64)
+	// RequestFinished is called when an operation is done, with its duration and resulting error
+	RequestFinished(op Operation, fileID FileID, duration time.Duration, err error)
+}
+
+// SetObserver sets the observer receiving callbacks about the requests of this file, nil disables it
+func (f *file) SetObserver(observer Observer) {
+	f.observer = observer
+}
+
+// observe reports the start of an operation to the observer and returns a function reporting its end
+func (f *file) observe(op Operation) func(n int64, err error) {
+	if f.observer == nil {
+		return func(int64, error) {}
+	}
+
+	f.observer.RequestStarted(op, f.fileID)
+	start := time.Now()
+	return func(n int64, err error) {
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		if n > 0 {
+			f.observer.BytesTransferred(op, f.fileID, n)
+		}
+		f.observer.RequestFinished(op, f.fileID, time.Since(start), err)
+	}
+}
+
+// DefaultLatencyBuckets are the upper bounds of the latency histogram buckets used when none are configured
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// LatencyHistogram counts durations in buckets
+type LatencyHistogram struct {
+	Buckets []time.Duration // Upper bounds of the buckets
+	Counts  []int64         // Counts per bucket, with one extra bucket for durations above the last bound
+	Sum     time.Duration   // Sum of all durations
+	Count   int64           // Amount of durations
+}
+
+// observe adds a duration to the histogram
+func (h *LatencyHistogram) observe(duration time.Duration) {
+	i := sort.Search(len(h.Buckets), func(i int) bool {
+		return duration <= h.Buckets[i]
+	})
+	h.Counts[i]++
+	h.Sum += duration
+	h.Count++
+}
+
+// Mean returns the mean duration
+func (h *LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// OperationMetrics are the aggregated metrics of a single operation type
+type OperationMetrics struct {
+	Requests int64 // Amount of finished operations
+	Errors   int64 // Amount of finished operations that resulted in an error
+	Retries  int64 // Amount of retried attempts
+	Bytes    int64 // Amount of file data transferred
+	InFlight int64 // Amount of operations that started but did not finish yet
+	Latency  LatencyHistogram
+}
+
+// MetricsObserver is an Observer aggregating counters and latency histograms per operation type
+type MetricsObserver struct {
+	buckets    []time.Duration
+	operations map[Operation]*OperationMetrics
+	mu         sync.Mutex
+}
+
+// NewMetricsObserver creates a new MetricsObserver with the given latency bucket bounds, or DefaultLatencyBuckets if none are given
+func NewMetricsObserver(buckets ...time.Duration) *MetricsObserver {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]time.Duration{}, buckets...)
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i] < buckets[j]
+	})
+
+	return &MetricsObserver{
+		buckets:    buckets,
+		operations: make(map[Operation]*OperationMetrics),
+	}
+}
+
+// RequestStarted counts an operation as in flight
+func (m *MetricsObserver) RequestStarted(op Operation, _ FileID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metrics(op).InFlight++
+}
+
+// RequestRetried counts a retried attempt
+func (m *MetricsObserver) RequestRetried(op Operation, _ FileID, _ int, _ error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metrics(op).Retries++
+}
+
+// BytesTransferred counts transferred bytes
+func (m *MetricsObserver) BytesTransferred(op Operation, _ FileID, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metrics(op).Bytes += n
+}
+
+// RequestFinished counts a finished operation and its latency
+func (m *MetricsObserver) RequestFinished(op Operation, _ FileID, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metrics := m.metrics(op)
+	metrics.InFlight--
+	metrics.Requests++
+	if err != nil {
+		metrics.Errors++
+	}
+	metrics.Latency.observe(duration)
+}
+
+// Metrics returns a copy of the metrics of all operation types seen so far
+func (m *MetricsObserver) Metrics() map[Operation]OperationMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[Operation]OperationMetrics, len(m.operations))
+	for op, metrics := range m.operations {
+		cp := *metrics
+		cp.Latency.Counts = append([]int64{}, metrics.Latency.Counts...)
+		snapshot[op] = cp
+	}
+	return snapshot
+}
+
+// metrics returns the metrics of the operation type, assumes the lock is held
+func (m *MetricsObserver) metrics(op Operation) *OperationMetrics {
+	metrics := m.operations[op]
+	if metrics == nil {
+		metrics = &OperationMetrics{
+			Latency: LatencyHistogram{
+				Buckets: m.buckets,
+				Counts:  make([]int64, len(m.buckets)+1),
+			},
+		}
+		m.operations[op] = metrics
+	}
+	return metrics
+}
@@ -0,0 +1,129 @@
+package networkfile
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsObserver(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := flakyServer(srv, 1, http.StatusServiceUnavailable, &requests)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "observer-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	observer := NewMetricsObserver()
+	client := NewClient(testServer.URL+prefix,
+		WithSharedSecret(secret),
+		WithRetryPolicy(testRetryPolicy()),
+		WithObserver(observer),
+	)
+
+	wrtr := client.OpenWriter(context.Background(), fileID)
+	_, err = wrtr.WriteAt(make([]byte, 1000), 0)
+	assert.NoError(t, err)
+	_, err = wrtr.WriteAt(make([]byte, 500), 1000)
+	assert.NoError(t, err)
+	fi, err := wrtr.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1500, fi.Size())
+
+	// Reading a file that is not served results in an error
+	rdr := client.OpenReader(context.Background(), fileID)
+	_, err = rdr.ReadAt(make([]byte, 10), 0)
+	assert.ErrorIs(t, err, ErrUnknownFile)
+
+	assert.NoError(t, wrtr.Close())
+
+	metrics := observer.Metrics()
+
+	write := metrics[OperationWrite]
+	assert.EqualValues(t, 2, write.Requests)
+	assert.EqualValues(t, 0, write.Errors)
+	assert.EqualValues(t, 1, write.Retries)
+	assert.EqualValues(t, 1500, write.Bytes)
+	assert.EqualValues(t, 0, write.InFlight)
+	assert.EqualValues(t, 2, write.Latency.Count)
+	assert.Len(t, write.Latency.Counts, len(DefaultLatencyBuckets)+1)
+
+	stat := metrics[OperationStat]
+	assert.EqualValues(t, 1, stat.Requests)
+	assert.EqualValues(t, 0, stat.Errors)
+
+	read := metrics[OperationRead]
+	assert.EqualValues(t, 1, read.Requests)
+	assert.EqualValues(t, 1, read.Errors)
+	assert.EqualValues(t, 0, read.Bytes)
+
+	assert.EqualValues(t, 1, metrics[OperationClose].Requests)
+}
+
+func TestMetricsObserverStream(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(10_000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	observer := NewMetricsObserver()
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.SetObserver(observer)
+	rdr.SetStreaming(true)
+
+	n, err := io.Copy(io.Discard, io.LimitReader(rdr, 4000))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4000, n)
+
+	read := observer.Metrics()[OperationRead]
+	assert.EqualValues(t, 1, read.InFlight)
+	assert.EqualValues(t, 0, read.Requests)
+
+	assert.NoError(t, rdr.Close())
+
+	read = observer.Metrics()[OperationRead]
+	assert.EqualValues(t, 0, read.InFlight)
+	assert.EqualValues(t, 1, read.Requests)
+	assert.EqualValues(t, 4000, read.Bytes)
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	observer := NewMetricsObserver(time.Second, 10*time.Millisecond)
+	observer.RequestStarted(OperationRead, "")
+	observer.RequestFinished(OperationRead, "", 5*time.Millisecond, nil)
+	observer.RequestStarted(OperationRead, "")
+	observer.RequestFinished(OperationRead, "", 15*time.Millisecond, nil)
+	observer.RequestStarted(OperationRead, "")
+	observer.RequestFinished(OperationRead, "", 2*time.Second, nil)
+
+	latency := observer.Metrics()[OperationRead].Latency
+	assert.EqualValues(t, []time.Duration{10 * time.Millisecond, time.Second}, latency.Buckets)
+	assert.EqualValues(t, []int64{1, 1, 1}, latency.Counts)
+	assert.EqualValues(t, 3, latency.Count)
+	assert.Equal(t, 2020*time.Millisecond/3, latency.Mean())
+}
@@ -0,0 +1,260 @@
+package networkfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Operation is an operation performed on a remote file
+type Operation string
+
+const (
+	// OperationTruncate changes the size of the file
+	OperationTruncate Operation = "truncate"
+
+	// OperationSync commits the contents of the file to stable storage
+	OperationSync Operation = "sync"
+
+	// OperationAllocate makes sure space is allocated for a range of the file
+	OperationAllocate Operation = "allocate"
+
+	// OperationStat retrieves the file information
+	OperationStat Operation = "stat"
+
+	// OperationRead reads from the file
+	OperationRead Operation = "read"
+
+	// OperationWrite writes to the file
+	OperationWrite Operation = "write"
+
+	// OperationClose closes the file
+	OperationClose Operation = "close"
+
+	// OperationList lists the served files
+	OperationList Operation = "list"
+)
+
+const (
+	// HeaderOperation is the header used to specify the operation of a POST request
+	HeaderOperation = "X-Operation"
+
+	// HeaderSize is the header used to specify the new size of a truncated file
+	HeaderSize = "X-Size"
+)
+
+// Truncater is an interface for files which implement truncating
+type Truncater interface {
+	Truncate(size int64) error
+}
+
+// Syncer is an interface for files which implement committing to stable storage
+type Syncer interface {
+	Sync() error
+}
+
+// Allocator is an interface for files which implement preallocating space
+type Allocator interface {
+	Allocate(offset, length int64) error
+}
+
+// Truncate changes the size of the remote file, after flushing buffered writes
+func (w *Writer) Truncate(size int64) error {
+	if size < 0 {
+		return fmt.Errorf("invalid size %d", size)
+	}
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+	return w.operate(OperationTruncate, func(req *http.Request) {
+		req.Header.Set(HeaderSize, strconv.FormatInt(size, 10))
+	})
+}
+
+// Sync flushes buffered writes and tells the server to commit the remote file to stable storage
+func (w *Writer) Sync() error {
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+	return w.operate(OperationSync, nil)
+}
+
+// Allocate tells the server to make sure space is allocated for the given range of the remote file,
+// extending the file if the range lies beyond its end
+func (w *Writer) Allocate(offset, length int64) error {
+	if offset < 0 || length < 1 {
+		return fmt.Errorf("invalid range %d-%d", offset, length)
+	}
+	return w.operate(OperationAllocate, func(req *http.Request) {
+		req.Header.Set(HeaderRange, fmt.Sprintf("%d-%d", offset, length))
+	})
+}
+
+// SyncOnClose sets whether Close should issue a Sync before closing the remote file
+func (w *Writer) SyncOnClose(enabled bool) {
+	w.syncOnClose = enabled
+}
+
+// operate asks the server to perform the given operation on the remote file
+func (w *Writer) operate(op Operation, prepare func(req *http.Request)) (err error) {
+	done := w.observe(op)
+	defer func() {
+		done(0, err)
+	}()
+
+	url := fmt.Sprintf("%s/%s", w.baseURL, w.fileID)
+	req, err := w.prepareRequest(http.MethodPost, url, nil) // nolint:noctx
+	if err != nil {
+		w.logger.Error("networkfile.Writer.operate: Error creating request", "fileID", w.fileID, "operation", op, "error", err)
+		return err
+	}
+	req.Header.Set(HeaderOperation, string(op))
+	if prepare != nil {
+		prepare(req)
+	}
+
+	resp, err := w.do(op, req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			w.logger.Info("networkfile.Writer.operate: Context expired", "fileID", w.fileID, "operation", op, "error", err)
+		} else {
+			w.logger.Error("networkfile.Writer.operate: Error executing request", "fileID", w.fileID, "operation", op, "error", err)
+		}
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	err = responseCodeToError(resp, http.StatusNoContent)
+	if err != nil {
+		w.logger.Info("networkfile.Writer.operate: A remote error occurred", "fileID", w.fileID, "operation", op, "error", err)
+		return err
+	}
+
+	w.logger.Debug("networkfile.Writer.operate: Performed operation", "fileID", w.fileID, "operation", op)
+	return nil
+}
+
+// handleOperation handles http requests to truncate, sync or allocate a writer
+func (fs *FileServer) handleOperation(resp http.ResponseWriter, req *http.Request, fileID FileID) {
+	fs.mu.RLock()
+	writer := fs.writers[fileID]
+	fs.mu.RUnlock()
+
+	if writer == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var err error
+	op := Operation(req.Header.Get(HeaderOperation))
+	switch op {
+	case OperationTruncate:
+		size, parseErr := strconv.ParseInt(req.Header.Get(HeaderSize), 10, 64)
+		if parseErr != nil || size < 0 {
+			fs.logger.Debug("networkfile.FileServer.handleOperation: Invalid size", "size", req.Header.Get(HeaderSize))
+			resp.WriteHeader(http.StatusBadRequest)
+			_, _ = resp.Write([]byte("invalid size"))
+			return
+		}
+		err = writer.truncate(size)
+	case OperationSync:
+		err = writer.sync()
+	case OperationAllocate:
+		offset, length, ok := fs.requestOffsetAndLength(resp, req)
+		if !ok {
+			return
+		}
+		err = writer.allocate(offset, length)
+	default:
+		fs.logger.Debug("networkfile.FileServer.handleOperation: Invalid operation", "operation", op)
+		resp.WriteHeader(http.StatusBadRequest)
+		_, _ = resp.Write([]byte("invalid operation"))
+		return
+	}
+
+	if err != nil {
+		if !errors.Is(err, ErrUnsupportedOperation) {
+			fs.logger.Error("networkfile.FileServer.handleOperation: Error performing operation",
+				"fileID", fileID, "operation", op, "error", err)
+		}
+		writeErrorToResponseWriter(resp, err)
+		return
+	}
+
+	fs.logger.Debug("networkfile.FileServer.handleOperation: Performed operation", "fileID", fileID, "operation", op)
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// truncate truncates the underlying writer if it supports it
+func (ws *concurrentWriteSeeker) truncate(size int64) error {
+	ws.lock.mu.Lock()
+	defer ws.lock.mu.Unlock()
+
+	truncater, ok := ws.handle().(Truncater)
+	if !ok {
+		return ErrUnsupportedOperation
+	}
+	err := truncater.Truncate(size)
+	if err != nil {
+		return err
+	}
+	ws.changes.Add(1)
+	ws.highWater.Store(size)
+	return nil
+}
+
+// sync commits the underlying writer to stable storage if it supports it
+func (ws *concurrentWriteSeeker) sync() error {
+	ws.lock.mu.Lock()
+	defer ws.lock.mu.Unlock()
+
+	syncer, ok := ws.handle().(Syncer)
+	if !ok {
+		return ErrUnsupportedOperation
+	}
+	return syncer.Sync()
+}
+
+// allocate allocates space in the underlying writer if it supports it. Writers that cannot allocate
+// but can be statted and truncated are extended to cover the range instead.
+func (ws *concurrentWriteSeeker) allocate(offset, length int64) error {
+	ws.lock.mu.Lock()
+	defer ws.lock.mu.Unlock()
+
+	if allocator, ok := ws.handle().(Allocator); ok {
+		err := allocator.Allocate(offset, length)
+		if err != nil {
+			return err
+		}
+		ws.wrote(offset + length)
+		return nil
+	}
+
+	truncater, ok := ws.handle().(Truncater)
+	if !ok {
+		return ErrUnsupportedOperation
+	}
+	statter, ok := ws.handle().(Statter)
+	if !ok {
+		return ErrUnsupportedOperation
+	}
+	fi, err := statter.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() >= offset+length {
+		return nil
+	}
+	err = truncater.Truncate(offset + length)
+	if err != nil {
+		return err
+	}
+	ws.wrote(offset + length)
+	return nil
+}
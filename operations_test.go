@@ -0,0 +1,83 @@
+package networkfile
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// seekOnlyWriter hides every method of a file other than Write and Seek
+type seekOnlyWriter struct {
+	io.WriteSeeker
+}
+
+func TestWriterOperations(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "writer-operations-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	wrtr.EnableWriteBuffer(1024)
+	wrtr.SyncOnClose(true)
+
+	_, err = wrtr.Write([]byte("Hello, World!"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, wrtr.Truncate(5))
+	fi, err := dst.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, fi.Size())
+
+	assert.NoError(t, wrtr.Allocate(100, 50))
+	fi, err = dst.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 150, fi.Size())
+
+	// Allocating a range within the file does not shrink it
+	assert.NoError(t, wrtr.Allocate(0, 10))
+	fi, err = dst.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 150, fi.Size())
+
+	assert.NoError(t, wrtr.Sync())
+	assert.NoError(t, wrtr.Close())
+}
+
+func TestWriterOperationsUnsupported(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "writer-operations-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, seekOnlyWriter{dst})
+	assert.NoError(t, err)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	assert.Equal(t, ErrUnsupportedOperation, wrtr.Truncate(0))
+	assert.Equal(t, ErrUnsupportedOperation, wrtr.Sync())
+	assert.Equal(t, ErrUnsupportedOperation, wrtr.Allocate(0, 10))
+
+	wrtr.SyncOnClose(true)
+	assert.Equal(t, ErrUnsupportedOperation, wrtr.Close())
+}
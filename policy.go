@@ -0,0 +1,173 @@
+package networkfile
+
+import (
+	"context"
+	"net/http"
+)
+
+// HandleOption configures the access policy of a single served file
+type HandleOption func(p *handlePolicy)
+
+// handlePolicy overrides the access settings of the server for a single served file
+type handlePolicy struct {
+	allowStat    *bool
+	allowClose   *bool
+	allowFullGET *bool
+	allowPUT     *bool
+	grants       map[Identity]map[Operation]bool // Operations allowed per identity, overriding the grants of the server
+}
+
+// HandleAllowStat sets whether clients may stat the file, overriding AllowStat of the server
+func HandleAllowStat(allow bool) HandleOption {
+	return func(p *handlePolicy) {
+		p.allowStat = &allow
+	}
+}
+
+// HandleAllowClose sets whether clients may close the file, overriding AllowClose of the server
+func HandleAllowClose(allow bool) HandleOption {
+	return func(p *handlePolicy) {
+		p.allowClose = &allow
+	}
+}
+
+// HandleAllowFullGET sets whether the file may be read via a normal GET request, overriding AllowFullGET of the server
+func HandleAllowFullGET(allow bool) HandleOption {
+	return func(p *handlePolicy) {
+		p.allowFullGET = &allow
+	}
+}
+
+// HandleAllowPUT sets whether the file may be written via a PUT request, overriding AllowPUT of the server
+func HandleAllowPUT(allow bool) HandleOption {
+	return func(p *handlePolicy) {
+		p.allowPUT = &allow
+	}
+}
+
+// HandleGrant allows the identity to perform only the given operations on the file,
+// overriding the operations granted to it by GrantOperations
+func HandleGrant(identity Identity, ops ...Operation) HandleOption {
+	return func(p *handlePolicy) {
+		if p.grants == nil {
+			p.grants = make(map[Identity]map[Operation]bool)
+		}
+		p.grants[identity] = operationSet(ops)
+	}
+}
+
+// newHandlePolicy returns the policy for the options, or nil when there are none
+func newHandlePolicy(opts []HandleOption) *handlePolicy {
+	if len(opts) == 0 {
+		return nil
+	}
+	p := &handlePolicy{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// operationSet returns the operations as a set
+func operationSet(ops []Operation) map[Operation]bool {
+	set := make(map[Operation]bool, len(ops))
+	for _, op := range ops {
+		set[op] = true
+	}
+	return set
+}
+
+// GrantOperations allows the identity to perform only the given operations, on files that do not grant
+// it operations themselves. Without any operations, the identity can only access files that grant it access,
+// which makes for credentials that can for example only upload to the one file served for them.
+func (fs *FileServer) GrantOperations(identity Identity, ops ...Operation) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.grants == nil {
+		fs.grants = make(map[Identity]map[Operation]bool)
+	}
+	fs.grants[identity] = operationSet(ops)
+}
+
+// requestOperation returns the operation performed by the request
+func requestOperation(req *http.Request, fileID FileID) Operation {
+	switch req.Method {
+	case http.MethodOptions:
+		return OperationStat
+	case http.MethodGet:
+		if fileID == "" {
+			return OperationList
+		}
+		return OperationRead
+	case http.MethodPatch, http.MethodPut:
+		return OperationWrite
+	case http.MethodPost:
+		return Operation(req.Header.Get(HeaderOperation))
+	case http.MethodDelete:
+		return OperationClose
+	}
+	return ""
+}
+
+// handlePolicies returns the policies of the handles served under the FileID that the operation is performed on
+func (fs *FileServer) handlePolicies(fileID FileID, op Operation) []*handlePolicy {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	var policies []*handlePolicy
+	reader, writer := fs.readers[fileID], fs.writers[fileID]
+	if reader != nil && reader.policy != nil && op != OperationWrite && !isWriterOperation(op) {
+		policies = append(policies, reader.policy)
+	}
+	if writer != nil && writer.policy != nil && op != OperationRead {
+		policies = append(policies, writer.policy)
+	}
+	return policies
+}
+
+// isWriterOperation returns whether the operation is performed by the writer of a file
+func isWriterOperation(op Operation) bool {
+	return op == OperationTruncate || op == OperationSync || op == OperationAllocate
+}
+
+// permits returns whether the identity of the request context may perform the operation on the file
+func (fs *FileServer) permits(ctx context.Context, fileID FileID, op Operation) bool {
+	identity, _ := IdentityFromContext(ctx)
+
+	granted := false
+	for _, policy := range fs.handlePolicies(fileID, op) {
+		ops, ok := policy.grants[identity]
+		if !ok {
+			continue
+		}
+		if !ops[op] {
+			return false
+		}
+		granted = true
+	}
+	if granted {
+		return true
+	}
+
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	ops, ok := fs.grants[identity]
+	return !ok || ops[op]
+}
+
+// allowed returns the setting of the file, which is the setting of the server unless a handle overrides it.
+// A file is only allowed something when none of its handles disallow it.
+func (fs *FileServer) allowed(fileID FileID, op Operation, setting func(p *handlePolicy) *bool, global bool) bool {
+	overridden := false
+	allow := true
+	for _, policy := range fs.handlePolicies(fileID, op) {
+		if value := setting(policy); value != nil {
+			overridden = true
+			allow = allow && *value
+		}
+	}
+	if !overridden {
+		return global
+	}
+	return allow
+}
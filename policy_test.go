@@ -0,0 +1,105 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadOnlyCredential(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.SetAuthenticator(AnyAuthenticator(
+		NewSharedSecretAuthenticator(secret),
+		NewBearerTokenAuthenticator(map[string]Identity{"customer-token": "customer"}),
+	))
+	srv.AllowPUT(false)
+	srv.GrantOperations("customer")
+	testServer := httptest.NewServer(srv)
+
+	uploadID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "policy-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+	err = srv.ServeFileWriter(context.Background(), uploadID, dst,
+		HandleGrant("customer", OperationWrite),
+		HandleAllowPUT(true),
+	)
+	assert.NoError(t, err)
+	otherID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), otherID, bytes.NewReader(make([]byte, 100)))
+	assert.NoError(t, err)
+
+	put := func(auth AuthProvider, fileID FileID) int {
+		req, err := http.NewRequest(http.MethodPut, testServer.URL+prefix+"/"+string(fileID), strings.NewReader("upload"))
+		assert.NoError(t, err)
+		assert.NoError(t, auth.Authorize(req))
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusNoContent, put(BearerTokenAuth("customer-token"), uploadID))
+	data, err := os.ReadFile(dst.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "upload", string(data))
+
+	customer := NewClient(testServer.URL+prefix, WithAuthProvider(BearerTokenAuth("customer-token")))
+	_, err = customer.OpenWriter(context.Background(), uploadID).WriteAt([]byte("U"), 0)
+	assert.NoError(t, err)
+	_, err = customer.OpenWriter(context.Background(), uploadID).Stat()
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, customer.OpenWriter(context.Background(), uploadID).Close(), ErrForbidden)
+	_, err = customer.OpenReader(context.Background(), otherID).ReadAt(make([]byte, 10), 0)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// Identities without grants are unaffected, apart from the overridden settings of the handle
+	_, err = NewReader(context.Background(), testServer.URL+prefix, secret, otherID).ReadAt(make([]byte, 10), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, put(SharedSecretAuth(secret), uploadID))
+	assert.Equal(t, http.StatusForbidden, put(SharedSecretAuth(secret), otherID))
+}
+
+func TestHandleSettings(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), fileID, bytes.NewReader(make([]byte, 100)),
+		HandleAllowStat(false),
+		HandleAllowClose(false),
+		HandleAllowFullGET(false),
+	)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	_, err = rdr.Stat()
+	assert.ErrorIs(t, err, ErrUnsupportedOperation)
+	assert.ErrorIs(t, rdr.Close(), ErrForbidden)
+
+	resp, err := http.Get(rdr.FullReadURL())
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Settings of the server apply to other files
+	otherID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), otherID, bytes.NewReader(make([]byte, 100)))
+	assert.NoError(t, err)
+	other := NewReader(context.Background(), testServer.URL+prefix, secret, otherID)
+	_, err = other.Stat()
+	assert.NoError(t, err)
+	assert.NoError(t, other.Close())
+}
@@ -0,0 +1,281 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// concurrencyTracker records the maximum amount of concurrent calls
+type concurrencyTracker struct {
+	current, max int64
+	overlapped   chan struct{} // When set, calls wait until another call runs at the same time
+	once         sync.Once
+}
+
+func (c *concurrencyTracker) enter() {
+	current := atomic.AddInt64(&c.current, 1)
+	for {
+		max := atomic.LoadInt64(&c.max)
+		if current <= max || atomic.CompareAndSwapInt64(&c.max, max, current) {
+			break
+		}
+	}
+	if c.overlapped == nil {
+		return
+	}
+	if current > 1 {
+		c.once.Do(func() {
+			close(c.overlapped)
+		})
+	}
+	select {
+	case <-c.overlapped:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func (c *concurrencyTracker) leave() {
+	atomic.AddInt64(&c.current, -1)
+}
+
+// trackingBuffer is an in-memory io.ReaderAt and io.WriterAt that tracks its concurrent calls
+type trackingBuffer struct {
+	concurrencyTracker
+	data []byte
+	mu   sync.Mutex
+}
+
+func (s *trackingBuffer) ReadAt(buf []byte, offset int64) (int, error) {
+	s.enter()
+	defer s.leave()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return bytes.NewReader(s.data).ReadAt(buf, offset)
+}
+
+func (s *trackingBuffer) WriteAt(buf []byte, offset int64) (int, error) {
+	s.enter()
+	defer s.leave()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if end := int(offset) + len(buf); end > len(s.data) {
+		s.data = append(s.data, make([]byte, end-len(s.data))...)
+	}
+	return copy(s.data[offset:], buf), nil
+}
+
+func TestServeFileReaderAt(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(8000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	buffer := &trackingBuffer{
+		concurrencyTracker: concurrencyTracker{overlapped: make(chan struct{})},
+		data:               srcBuf,
+	}
+	err = srv.ServeFileReaderAt(context.Background(), fileID, buffer)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.SetParallelReads(1000, 8)
+
+	buf := make([]byte, 8000)
+	n, err := rdr.ReadAt(buf, 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 8000, n)
+	assert.Equal(t, srcBuf, buf)
+	assert.Greater(t, atomic.LoadInt64(&buffer.max), int64(1))
+
+	// A ReaderAt of unknown size is streamed as a whole by a normal GET
+	resp, err := http.Get(rdr.FullReadURL())
+	assert.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, srcBuf, data)
+}
+
+func TestServeFileWriterAt(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(8000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	buffer := &trackingBuffer{
+		concurrencyTracker: concurrencyTracker{overlapped: make(chan struct{})},
+	}
+	err = srv.ServeFileWriterAt(context.Background(), fileID, buffer)
+	assert.NoError(t, err)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	wrtr.EnablePipelining(8)
+	for offset := 0; offset < len(srcBuf); offset += 1000 {
+		_, err = wrtr.WriteAt(srcBuf[offset:offset+1000], int64(offset))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, wrtr.Flush())
+	assert.Equal(t, srcBuf, buffer.data)
+	assert.Greater(t, atomic.LoadInt64(&buffer.max), int64(1))
+}
+
+func TestServeFileReaderPositional(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(5000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+	assert.NotNil(t, srv.readers[fileID].rdrAt)
+
+	// Positional reads do not move the offset of the file
+	_, err = src.Seek(10, io.SeekStart)
+	assert.NoError(t, err)
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	buf := make([]byte, 100)
+	_, err = rdr.ReadAt(buf, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, srcBuf[1000:1100], buf)
+	off, err := src.Seek(0, io.SeekCurrent)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 10, off)
+
+	resp, err := http.Get(rdr.FullReadURL())
+	assert.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.EqualValues(t, 5000, resp.ContentLength)
+	assert.Equal(t, srcBuf, data)
+}
+
+func TestServeFilePositionalStatUnlocked(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "positional-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+	err = srv.ServeFile(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	// Versioning reads and writes stats the file, which must not wait for the lock of the handle
+	srv.readers[fileID].lock.mu.Lock()
+	defer srv.readers[fileID].lock.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	f := NewFile(ctx, testServer.URL+prefix, secret, fileID)
+	_, err = f.WriteAt([]byte("hello"), 0)
+	assert.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = f.ReadAt(buf, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+	_, err = f.Stat()
+	assert.NoError(t, err)
+}
+
+func TestServeFileWriterAppendMode(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "positional-append-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+	appending, err := os.OpenFile(dst.Name(), os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	defer func() {
+		_ = appending.Close()
+	}()
+
+	// Files opened with O_APPEND refuse positional writes, so they are written by seeking instead
+	err = srv.ServeFileWriter(context.Background(), fileID, appending)
+	assert.NoError(t, err)
+	assert.Nil(t, srv.writers[fileID].wrtrAt)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	_, err = wrtr.WriteAt([]byte("hello"), 0)
+	assert.NoError(t, err)
+	_, err = wrtr.WriteAt([]byte(" world"), 5)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(dst.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+}
+
+func TestHandleLockRanges(t *testing.T) {
+	lock := &handleLock{}
+	lock.lockRange(0, 10)
+
+	// Ranges that do not overlap are locked at the same time
+	lock.lockRange(10, 20)
+	lock.unlockRange(10, 20)
+
+	locked := make(chan struct{})
+	go func() {
+		lock.lockRange(5, 15)
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		assert.Fail(t, "overlapping range locked while the range is held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	lock.unlockRange(0, 10)
+	<-locked
+	lock.unlockRange(5, 15)
+	assert.Empty(t, lock.writing)
+}
@@ -0,0 +1,113 @@
+package networkfile
+
+import (
+	"sort"
+)
+
+// byteRange is a half-open range of bytes from Start up to but not including End
+type byteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// byteRanges is a sorted set of ranges that never overlap or touch each other
+type byteRanges []byteRange
+
+// add adds the range to the set, merging it with overlapping and adjacent ranges
+func (r *byteRanges) add(start, end int64) {
+	if end <= start {
+		return
+	}
+	ranges := *r
+
+	first := sort.Search(len(ranges), func(i int) bool {
+		return ranges[i].End >= start
+	})
+	last := first
+	for last < len(ranges) && ranges[last].Start <= end {
+		start = min(start, ranges[last].Start)
+		end = max(end, ranges[last].End)
+		last++
+	}
+
+	merged := make(byteRanges, 0, len(ranges)-(last-first)+1)
+	merged = append(merged, ranges[:first]...)
+	merged = append(merged, byteRange{Start: start, End: end})
+	merged = append(merged, ranges[last:]...)
+	*r = merged
+}
+
+// remove removes the range from the set, splitting the ranges it partially overlaps
+func (r *byteRanges) remove(start, end int64) {
+	if end <= start {
+		return
+	}
+	var kept byteRanges
+	for _, rng := range *r {
+		if rng.End <= start || rng.Start >= end {
+			kept = append(kept, rng)
+			continue
+		}
+		if rng.Start < start {
+			kept = append(kept, byteRange{Start: rng.Start, End: start})
+		}
+		if rng.End > end {
+			kept = append(kept, byteRange{Start: end, End: rng.End})
+		}
+	}
+	*r = kept
+}
+
+// contiguousEnd returns the end of the range containing the offset, or the offset itself if it is not contained
+func (r byteRanges) contiguousEnd(offset int64) int64 {
+	for _, rng := range r {
+		if rng.Start <= offset && offset < rng.End {
+			return rng.End
+		}
+	}
+	return offset
+}
+
+// missing returns the parts of the range from start to end that are not in the set
+func (r byteRanges) missing(start, end int64) byteRanges {
+	var missing byteRanges
+	for _, rng := range r {
+		if rng.End <= start {
+			continue
+		}
+		if rng.Start >= end {
+			break
+		}
+		if rng.Start > start {
+			missing = append(missing, byteRange{Start: start, End: rng.Start})
+		}
+		start = rng.End
+	}
+	if start < end {
+		missing = append(missing, byteRange{Start: start, End: end})
+	}
+	return missing
+}
+
+// clip returns the set with everything from the given offset onwards removed
+func (r byteRanges) clip(end int64) byteRanges {
+	var clipped byteRanges
+	for _, rng := range r {
+		if rng.Start >= end {
+			break
+		}
+		clipped = append(clipped, byteRange{Start: rng.Start, End: min(rng.End, end)})
+	}
+	return clipped
+}
+
+// split splits the ranges into ranges of at most the given size
+func (r byteRanges) split(size int64) byteRanges {
+	var chunks byteRanges
+	for _, rng := range r {
+		for start := rng.Start; start < rng.End; start += size {
+			chunks = append(chunks, byteRange{Start: start, End: min(start+size, rng.End)})
+		}
+	}
+	return chunks
+}
@@ -1,105 +1,183 @@
 package networkfile
 
 import (
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
+	"sync"
 )
 
 // Reader is a byte reader for a remote io.Reader served by a FileServer
 type Reader struct {
 	file
+	cache       *blockCache
+	chunkSize   int // Reads larger than this are split into multiple requests, 0 disables splitting
+	parallelism int // Maximum amount of concurrent requests for a single split read
+	streaming   bool
+	stream      *readStream
+	version     string // Version of the remote file pinned by the first read
+	noPinning   bool   // Whether reads accept changes of the remote file, instead of pinning its version
+	versionMu   sync.Mutex
 }
 
 // NewReader creates a new remote Reader for the given URL, shared secret and FileID
 func NewReader(ctx context.Context, baseURL, sharedSecret string, fileID FileID) *Reader {
-	return &Reader{
-		file: file{
-			client:       http.DefaultClient,
-			ctx:          ctx,
-			baseURL:      baseURL,
-			sharedSecret: sharedSecret,
-			fileID:       fileID,
-			offset:       0,
-			logger:       slog.Default(),
-		},
-	}
+	return NewClient(baseURL, WithSharedSecret(sharedSecret)).OpenReader(ctx, fileID)
 }
 
 // NewCustomClientReader creates a new remote Reader for the given HTTP file, URL, shared secret and FileID
 func NewCustomClientReader(ctx context.Context, httpClient *http.Client, baseURL, sharedSecret string, fileID FileID) *Reader {
-	return &Reader{
-		file: file{
-			client:       httpClient,
-			ctx:          ctx,
-			baseURL:      baseURL,
-			sharedSecret: sharedSecret,
-			fileID:       fileID,
-			offset:       0,
-			logger:       slog.Default(),
-		},
-	}
+	return NewClient(baseURL, WithHTTPClient(httpClient), WithSharedSecret(sharedSecret)).OpenReader(ctx, fileID)
 }
 
-// FullReadURL returns the URL at which the file can be downloaded completely via a normal GET request without this reader
+// FullReadURL returns the URL at which the file can be downloaded completely via a normal GET request without this reader.
+// The URL contains the shared secret, use SignedReadURL to hand out a URL that expires and only grants access to this file.
 func (r *Reader) FullReadURL() string {
 	return fmt.Sprintf("%s/%s?%s=%s", r.baseURL, r.fileID, GETSharedSecret, r.sharedSecret)
 }
 
+// EnableBlockCache enables a client side cache of fixed size blocks for this reader.
+// Reads are served from the cache where possible, and once sequential reading is detected
+// the following blocks are prefetched in the background, up to the size reported by Stat.
+// Cached blocks are dropped when Stat reports a changed size or modification time, after
+// which the changed file is accepted.
+// It should be called before the reader is used.
+func (r *Reader) EnableBlockCache(cfg BlockCacheConfig) {
+	r.cache = newBlockCache(r, cfg)
+	r.onStat = r.cache.validate
+}
+
 // Read reads from the remote file
 func (r *Reader) Read(buf []byte) (n int, err error) {
-	n, err = r.read(buf, r.offset)
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	if r.streaming {
+		return r.readStream(buf)
+	}
+
+	if r.cache != nil {
+		n, err = r.cache.readAt(buf, r.offset)
+	} else {
+		n, err = r.readAt(buf, r.offset)
+	}
 	r.offset += int64(n)
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
 	return n, err
 }
 
 // ReadAt reads from the remote file at a given offset
 func (r *Reader) ReadAt(buf []byte, offset int64) (n int, err error) {
-	return r.read(buf, offset)
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	if r.cache != nil {
+		return r.cache.readAt(buf, offset)
+	}
+
+	n, err = r.readAt(buf, offset)
+	if err == nil && n < len(buf) {
+		err = io.EOF
+	}
+	return n, err
 }
 
-func (r *Reader) read(buf []byte, offset int64) (n int, err error) {
-	url := fmt.Sprintf("%s/%s", r.baseURL, r.fileID)
+// SetParallelReads splits reads larger than chunkSize into sub-ranges of chunkSize bytes,
+// which are fetched with at most parallelism concurrent requests.
+// A chunkSize of 0 disables splitting.
+func (r *Reader) SetParallelReads(chunkSize, parallelism int) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	r.chunkSize = chunkSize
+	r.parallelism = parallelism
+}
 
-	req, err := r.prepareRequest(http.MethodGet, url, nil) // nolint:noctx
-	if err != nil {
-		r.logger.Error("networkfile.Reader.read: Error creating request", "fileID", r.fileID, "error", err)
-		return 0, err
+// readAt reads from the remote file, splitting the read into multiple requests if needed
+func (r *Reader) readAt(buf []byte, offset int64) (n int, err error) {
+	if r.chunkSize > 0 && len(buf) > r.chunkSize {
+		return r.readSplit(buf, offset)
 	}
-	req.Header.Set(HeaderRange, fmt.Sprintf("%d-%d", offset, len(buf)))
+	return r.read(r.ctx, buf, offset)
+}
 
-	resp, err := r.client.Do(req)
-	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
-			r.logger.Info("networkfile.Reader.read: Context expired", "fileID", r.fileID, "error", err)
-		} else {
-			r.logger.Error("networkfile.Reader.read: Error executing request", "fileID", r.fileID, "error", err)
+// readSplit fetches the buffer in chunks concurrently and reassembles the results in place
+func (r *Reader) readSplit(buf []byte, offset int64) (n int, err error) {
+	type chunkResult struct {
+		n   int
+		err error
+	}
+
+	chunks := (len(buf) + r.chunkSize - 1) / r.chunkSize
+	results := make([]chunkResult, chunks)
+	semaphore := make(chan struct{}, r.parallelism)
+	wg := sync.WaitGroup{}
+	for i := 0; i < chunks; i++ {
+		start := i * r.chunkSize
+		end := min(start+r.chunkSize, len(buf))
+
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(i, start, end int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			results[i].n, results[i].err = r.read(r.ctx, buf[start:end], offset+int64(start))
+		}(i, start, end)
+	}
+	wg.Wait()
+
+	for i, res := range results {
+		n += res.n
+		if res.err != nil && !errors.Is(res.err, io.EOF) {
+			return n, res.err
+		}
+		if res.n < min(r.chunkSize, len(buf)-i*r.chunkSize) {
+			return n, io.EOF
 		}
-		return 0, err
 	}
+
+	r.logger.Debug("networkfile.Reader.readSplit: Read chunks", "fileID", r.fileID, "chunks", chunks, "bytes", n)
+	return n, nil
+}
+
+func (r *Reader) read(ctx context.Context, buf []byte, offset int64) (n int, err error) {
+	done := r.observe(OperationRead)
 	defer func() {
-		_ = resp.Body.Close()
+		done(int64(n), err)
 	}()
 
-	err = responseCodeToError(resp, http.StatusPartialContent)
+	body, err := r.openRange(ctx, offset, int64(len(buf)))
 	if err != nil {
-		r.logger.Info("networkfile.Reader.read: A remote error occurred", "fileID", r.fileID, "error", err)
 		return 0, err
 	}
+	defer func() {
+		_ = body.Close()
+	}()
 
 	for len(buf) > 0 && err == nil {
 		var copied int
-		copied, err = resp.Body.Read(buf)
+		copied, err = body.Read(buf)
 		n += copied
 		buf = buf[copied:]
 	}
+	if err == nil {
+		// Read until the end of the body, so the digest trailer can be verified
+		_, err = io.Copy(io.Discard, body)
+	}
 
 	if err != nil && !errors.Is(err, io.EOF) {
 		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
 			r.logger.Info("networkfile.Reader.read: Context expired", "fileID", r.fileID, "error", err)
+		} else if errors.Is(err, ErrChecksumMismatch) {
+			r.logger.Error("networkfile.Reader.read: Checksum mismatch", "fileID", r.fileID, "offset", offset)
+			return 0, err
 		} else {
 			r.logger.Error("networkfile.Reader.read: Error reading http body", "fileID", r.fileID, "error", err)
 		}
@@ -110,3 +188,81 @@ func (r *Reader) read(buf []byte, offset int64) (n int, err error) {
 	}
 	return n, nil
 }
+
+// rangeBody is the decoded body of a ranged read response
+type rangeBody struct {
+	io.Reader
+	resp *http.Response
+}
+
+// Close closes the response body
+func (b *rangeBody) Close() error {
+	return b.resp.Body.Close()
+}
+
+// openRange requests the given range of the remote file with a request bound to the given context
+// and returns the decoded response body
+func (r *Reader) openRange(ctx context.Context, offset, length int64) (*rangeBody, error) {
+	url := fmt.Sprintf("%s/%s", r.baseURL, r.fileID)
+
+	req, err := r.prepareRequestContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		r.logger.Error("networkfile.Reader.openRange: Error creating request", "fileID", r.fileID, "error", err)
+		return nil, err
+	}
+	req.Header.Set(HeaderRange, fmt.Sprintf("%d-%d", offset, length))
+	if version := r.Version(); version != "" {
+		req.Header.Set(HeaderIfMatch, version)
+	}
+	if r.digest != "" {
+		if _, ok := r.digest.newHash(); !ok {
+			r.logger.Error("networkfile.Reader.openRange: Unsupported digest algorithm", "fileID", r.fileID, "algorithm", r.digest)
+			return nil, ErrUnsupportedOperation
+		}
+		req.Header.Set(HeaderWantDigest, string(r.digest))
+	}
+	// Setting the header ourselves disables transparent decompression by the transport
+	if r.compression {
+		req.Header.Set(HeaderAcceptEncoding, EncodingGzip)
+	} else {
+		req.Header.Set(HeaderAcceptEncoding, "identity")
+	}
+
+	resp, err := r.do(OperationRead, req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			r.logger.Info("networkfile.Reader.openRange: Context expired", "fileID", r.fileID, "error", err)
+		} else {
+			r.logger.Error("networkfile.Reader.openRange: Error executing request", "fileID", r.fileID, "error", err)
+		}
+		return nil, err
+	}
+
+	err = responseCodeToError(resp, http.StatusPartialContent)
+	if err == nil {
+		err = r.pinVersion(resp.Header.Get(HeaderETag))
+	}
+	if err != nil {
+		_ = resp.Body.Close()
+		r.logger.Info("networkfile.Reader.openRange: A remote error occurred", "fileID", r.fileID, "error", err)
+		return nil, err
+	}
+
+	body := &rangeBody{
+		Reader: resp.Body,
+		resp:   resp,
+	}
+	if resp.Header.Get(HeaderContentEncoding) == EncodingGzip {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			_ = resp.Body.Close()
+			r.logger.Error("networkfile.Reader.openRange: Error decompressing http body", "fileID", r.fileID, "error", err)
+			return nil, err
+		}
+		body.Reader = gz
+	}
+	if r.digest != "" {
+		body.Reader = newDigestReader(resp, body.Reader, r.digest)
+	}
+	return body, nil
+}
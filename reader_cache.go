@@ -0,0 +1,325 @@
+package networkfile
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// BlockCacheConfig configures the client side block cache of a Reader
+type BlockCacheConfig struct {
+	BlockSize int   // Size in bytes of a single cached block
+	MaxMemory int64 // Maximum amount of bytes kept in the cache
+	ReadAhead int   // Amount of blocks to prefetch in the background once a sequential read is detected
+}
+
+const (
+	// DefaultCacheBlockSize is the block size used when none is configured
+	DefaultCacheBlockSize = 256 * 1024
+
+	// DefaultCacheMaxMemory is the memory budget used when none is configured
+	DefaultCacheMaxMemory = 16 * 1024 * 1024
+)
+
+// cachedBlock is a single block of remote file data
+type cachedBlock struct {
+	index int64
+	data  []byte
+}
+
+// blockFetch is an in-progress fetch of a single block, shared by everyone waiting for it
+type blockFetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// blockCache is an LRU cache of fixed size blocks of a remote file
+type blockCache struct {
+	rdr        *Reader
+	ctx        context.Context // Context of block fetches, cancelled when the reader is closed
+	cancel     context.CancelFunc
+	blockSize  int64
+	maxBlocks  int
+	readAhead  int
+	blocks     map[int64]*list.Element
+	lru        *list.List
+	fetches    map[int64]*blockFetch
+	generation uint64 // Incremented on invalidation, so fetches started before it are not stored
+	eofBlock   int64  // Index of the first block known to be short, or -1
+	lastBlock  int64  // Last block index touched by a read
+	sequential int    // Amount of consecutive reads that continued where the previous one stopped
+	refreshing bool   // Whether the size is being refreshed in the background
+	refreshed  int64  // Last block of the read-ahead window the size was last refreshed for, or -1
+	statKnown  bool
+	size       int64
+	modTime    int64
+	mu         sync.Mutex
+}
+
+func newBlockCache(rdr *Reader, cfg BlockCacheConfig) *blockCache {
+	if cfg.BlockSize <= 0 {
+		cfg.BlockSize = DefaultCacheBlockSize
+	}
+	if cfg.MaxMemory <= 0 {
+		cfg.MaxMemory = DefaultCacheMaxMemory
+	}
+	maxBlocks := int(cfg.MaxMemory / int64(cfg.BlockSize))
+	if maxBlocks < 1 {
+		maxBlocks = 1
+	}
+	if cfg.ReadAhead < 0 {
+		cfg.ReadAhead = 0
+	}
+	ctx := rdr.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &blockCache{
+		rdr:       rdr,
+		ctx:       ctx,
+		cancel:    cancel,
+		blockSize: int64(cfg.BlockSize),
+		maxBlocks: maxBlocks,
+		readAhead: cfg.ReadAhead,
+		blocks:    make(map[int64]*list.Element),
+		lru:       list.New(),
+		fetches:   make(map[int64]*blockFetch),
+		eofBlock:  -1,
+		lastBlock: -2,
+		refreshed: -1,
+	}
+}
+
+// readAt reads into the buffer from the cache, fetching missing blocks from the remote file.
+// It follows the io.ReaderAt contract and returns io.EOF when the buffer could not be filled.
+func (c *blockCache) readAt(buf []byte, offset int64) (n int, err error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	c.track(offset/c.blockSize, (offset+int64(len(buf))-1)/c.blockSize)
+
+	// The file may have grown since its size was seen, so the size is refreshed once before reporting its end
+	refreshed := false
+	atEOF := func(pos int64) bool {
+		if refreshed {
+			return true
+		}
+		refreshed = true
+		return !c.refreshSize(pos)
+	}
+
+	for n < len(buf) {
+		pos := offset + int64(n)
+		if c.pastEOF(pos) {
+			if atEOF(pos) {
+				return n, io.EOF
+			}
+			continue
+		}
+		index := pos / c.blockSize
+		data, err := c.block(index)
+		if err != nil {
+			return n, err
+		}
+
+		start := pos - index*c.blockSize
+		if start < int64(len(data)) {
+			n += copy(buf[n:], data[start:])
+		}
+		if n < len(buf) && int64(len(data)) < c.blockSize && atEOF(offset+int64(n)) {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
+
+// track detects sequential reads and starts prefetching the blocks following them
+func (c *blockCache) track(first, last int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if first == c.lastBlock || first == c.lastBlock+1 {
+		c.sequential++
+	} else {
+		c.sequential = 0
+	}
+	c.lastBlock = last
+
+	if c.readAhead == 0 || c.sequential < 2 {
+		return
+	}
+	window := last + int64(c.readAhead)
+	if !c.statKnown || (window+1)*c.blockSize > c.size {
+		// Without the size, a file ending on a block boundary would be read ahead past its end, and a file that is
+		// still growing should be read ahead past the size seen before. The size is refreshed in the background at
+		// most once per read-ahead window, so reads never wait for it. Reads reaching the end refresh it themselves.
+		reachesEnd := c.statKnown && (last+1)*c.blockSize > c.size
+		if !c.refreshing && !reachesEnd && last > c.refreshed {
+			c.refreshing = true
+			c.refreshed = window
+			go c.refreshAndPrefetch()
+		}
+		if !c.statKnown {
+			return
+		}
+	}
+	c.prefetch(last)
+}
+
+// refreshAndPrefetch refreshes the size of the file, then prefetches the blocks following the last sequential read
+func (c *blockCache) refreshAndPrefetch() {
+	if c.ctx.Err() == nil {
+		_, _ = c.rdr.Stat()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshing = false
+	if c.ctx.Err() == nil && c.sequential >= 2 {
+		c.prefetch(c.lastBlock)
+	}
+}
+
+// prefetch starts fetching the blocks of the read-ahead window following the given block, assumes the lock is held
+func (c *blockCache) prefetch(last int64) {
+	for index := last + 1; index <= last+int64(c.readAhead); index++ {
+		if (c.eofBlock >= 0 && index > c.eofBlock) || (c.statKnown && index*c.blockSize >= c.size) {
+			return
+		}
+		if c.blocks[index] != nil || c.fetches[index] != nil {
+			continue
+		}
+		fetch := c.startFetch(index)
+		go c.runFetch(index, fetch, c.generation)
+	}
+}
+
+// pastEOF returns whether the offset lies beyond the known end of the file
+func (c *blockCache) pastEOF(offset int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.statKnown && offset >= c.size
+}
+
+// refreshSize asks the server for the size of the file and returns whether the file extends beyond the offset.
+// When the file changed, its cached blocks are dropped.
+func (c *blockCache) refreshSize(offset int64) bool {
+	fi, err := c.rdr.Stat()
+	return err == nil && fi.Size() > offset
+}
+
+// close cancels the fetches in progress and stops further fetches
+func (c *blockCache) close() {
+	c.cancel()
+}
+
+// block returns the data of the block with the given index, fetching it when it is not cached
+func (c *blockCache) block(index int64) ([]byte, error) {
+	c.mu.Lock()
+	elem := c.blocks[index]
+	if elem != nil {
+		c.lru.MoveToFront(elem)
+		data := elem.Value.(*cachedBlock).data
+		c.mu.Unlock()
+		return data, nil
+	}
+
+	fetch := c.fetches[index]
+	if fetch != nil {
+		c.mu.Unlock()
+		<-fetch.done
+		return fetch.data, fetch.err
+	}
+
+	fetch = c.startFetch(index)
+	generation := c.generation
+	c.mu.Unlock()
+
+	c.runFetch(index, fetch, generation)
+	return fetch.data, fetch.err
+}
+
+// startFetch registers a new fetch for the given block, assumes the lock is held
+func (c *blockCache) startFetch(index int64) *blockFetch {
+	fetch := &blockFetch{
+		done: make(chan struct{}),
+	}
+	c.fetches[index] = fetch
+	return fetch
+}
+
+// runFetch retrieves the block from the remote file and stores it in the cache
+func (c *blockCache) runFetch(index int64, fetch *blockFetch, generation uint64) {
+	buf := make([]byte, c.blockSize)
+	n, err := c.rdr.read(c.ctx, buf, index*c.blockSize)
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	fetch.data = buf[:n]
+	fetch.err = err
+
+	c.mu.Lock()
+	if c.fetches[index] == fetch {
+		delete(c.fetches, index)
+	}
+	if err == nil && generation == c.generation {
+		c.store(index, fetch.data)
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		c.rdr.logger.Debug("networkfile.Reader.fetchBlock: Error fetching block",
+			"fileID", c.rdr.fileID, "block", index, "error", err)
+	}
+	close(fetch.done)
+}
+
+// store adds a block to the cache and evicts the least recently used blocks, assumes the lock is held
+func (c *blockCache) store(index int64, data []byte) {
+	if int64(len(data)) < c.blockSize && (c.eofBlock < 0 || index < c.eofBlock) {
+		c.eofBlock = index
+	}
+
+	c.blocks[index] = c.lru.PushFront(&cachedBlock{
+		index: index,
+		data:  data,
+	})
+
+	for c.lru.Len() > c.maxBlocks {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.blocks, oldest.Value.(*cachedBlock).index)
+	}
+}
+
+// validate drops all cached blocks when the file information differs from what was seen before
+func (c *blockCache) validate(fi FileInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.statKnown && (c.size != fi.FileSize || c.modTime != fi.FileModTime) {
+		c.rdr.logger.Debug("networkfile.Reader.validateCache: Remote file changed, dropping cache",
+			"fileID", c.rdr.fileID, "size", fi.FileSize, "modTime", fi.FileModTime)
+		c.purge()
+		c.rdr.unpinVersion()
+	}
+	c.statKnown = true
+	c.size = fi.FileSize
+	c.modTime = fi.FileModTime
+}
+
+// purge removes all cached blocks, assumes the lock is held
+func (c *blockCache) purge() {
+	c.blocks = make(map[int64]*list.Element)
+	c.lru.Init()
+	c.fetches = make(map[int64]*blockFetch)
+	c.generation++
+	c.eofBlock = -1
+	c.sequential = 0
+	c.refreshed = -1
+}
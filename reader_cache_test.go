@@ -0,0 +1,253 @@
+package networkfile
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func countingServer(srv *FileServer, counter *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			atomic.AddInt64(counter, 1)
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+}
+
+func TestReaderBlockCache(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := countingServer(srv, &requests)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(10_000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.EnableBlockCache(BlockCacheConfig{
+		BlockSize: 4096,
+		MaxMemory: 4 * 4096,
+	})
+
+	dstBuf, err := io.ReadAll(bufio.NewReaderSize(rdr, 16))
+	assert.NoError(t, err)
+	assert.EqualValues(t, srcBuf, dstBuf)
+	assert.EqualValues(t, 3, atomic.LoadInt64(&requests))
+
+	buf := make([]byte, 100)
+	n, err := rdr.ReadAt(buf, 9_950)
+	assert.Equal(t, io.EOF, err)
+	assert.EqualValues(t, 50, n)
+	assert.EqualValues(t, srcBuf[9_950:], buf[:n])
+	assert.EqualValues(t, 3, atomic.LoadInt64(&requests))
+
+	assert.NoError(t, rdr.Close())
+}
+
+func TestReaderBlockCacheReadAhead(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := countingServer(srv, &requests)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(8 * 1024)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.EnableBlockCache(BlockCacheConfig{
+		BlockSize: 1024,
+		ReadAhead: 4,
+	})
+
+	buf := make([]byte, 1024)
+	for i := 0; i < 3; i++ {
+		_, err = io.ReadFull(rdr, buf)
+		assert.NoError(t, err)
+	}
+
+	// The third sequential read should have triggered prefetching of the next four blocks
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&requests) == 7
+	}, time.Second, time.Millisecond)
+
+	// The file ends on a block boundary, so nothing past the last block is fetched
+	for i := 0; i < 5; i++ {
+		_, err = io.ReadFull(rdr, buf)
+		assert.NoError(t, err)
+	}
+	_, err = io.ReadFull(rdr, buf)
+	assert.Equal(t, io.EOF, err)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&requests) == 8
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, rdr.Close())
+	assert.ErrorIs(t, rdr.cache.ctx.Err(), context.Canceled)
+}
+
+func TestReaderBlockCacheReadAheadStats(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var stats, reads int64
+	testServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodOptions:
+			atomic.AddInt64(&stats, 1)
+		case http.MethodGet:
+			atomic.AddInt64(&reads, 1)
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(100 * 1024)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.EnableBlockCache(BlockCacheConfig{
+		BlockSize: 16 * 1024,
+		ReadAhead: 4,
+	})
+
+	// The size is only refreshed to start reading ahead, and when reading reaches the end of the file
+	data, err := io.ReadAll(bufio.NewReaderSize(rdr, 16*1024))
+	assert.NoError(t, err)
+	assert.Len(t, data, 100*1024)
+	assert.EqualValues(t, 7, atomic.LoadInt64(&reads))
+	assert.LessOrEqual(t, atomic.LoadInt64(&stats), int64(3))
+
+	assert.NoError(t, rdr.Close())
+}
+
+func TestReaderBlockCacheGrowingFile(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := countingServer(srv, &requests)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(4 * 1024)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.EnableBlockCache(BlockCacheConfig{
+		BlockSize: 1024,
+		ReadAhead: 4,
+	})
+
+	buf := make([]byte, 1024)
+	for i := 0; i < 4; i++ {
+		_, err = io.ReadFull(rdr, buf)
+		assert.NoError(t, err)
+	}
+
+	// The file grows after its size was seen, reading on continues past the old end
+	_, err = src.WriteAt(make([]byte, 4*1024), 4*1024)
+	assert.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		_, err = io.ReadFull(rdr, buf)
+		assert.NoError(t, err)
+	}
+	_, err = io.ReadFull(rdr, buf)
+	assert.Equal(t, io.EOF, err)
+
+	assert.NoError(t, rdr.Close())
+}
+
+func TestReaderBlockCacheInvalidation(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := countingServer(srv, &requests)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(100)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.EnableBlockCache(BlockCacheConfig{
+		BlockSize: 1024,
+	})
+
+	_, err = rdr.Stat()
+	assert.NoError(t, err)
+
+	buf := make([]byte, 200)
+	n, err := rdr.ReadAt(buf, 0)
+	assert.Equal(t, io.EOF, err)
+	assert.EqualValues(t, 100, n)
+
+	_, err = src.WriteAt(make([]byte, 50), 100)
+	assert.NoError(t, err)
+
+	// Reads within the known size are served from the cache
+	n, err = rdr.ReadAt(buf[:50], 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 50, n)
+	assert.EqualValues(t, 1, atomic.LoadInt64(&requests))
+
+	// Reaching the known end refreshes the size, which drops the cache of the changed file
+	n, err = rdr.ReadAt(buf, 0)
+	assert.Equal(t, io.EOF, err)
+	assert.EqualValues(t, 150, n)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&requests))
+
+	fi, err := rdr.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 150, fi.Size())
+
+	n, err = rdr.ReadAt(buf, 0)
+	assert.Equal(t, io.EOF, err)
+	assert.EqualValues(t, 150, n)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&requests))
+
+	assert.NoError(t, rdr.Close())
+}
@@ -0,0 +1,180 @@
+package networkfile
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+)
+
+// streamReconnects is the amount of times a stream is reopened after failing without making progress
+const streamReconnects = 3
+
+// readStream is a long-lived ranged read from the current offset up to the end of the remote file
+type readStream struct {
+	body   *rangeBody
+	offset int64
+	read   int64                    // Bytes read from the stream
+	err    error                    // Error that ended the stream
+	done   func(n int64, err error) // Reports the end of the stream to the observer
+}
+
+// SetStreaming sets whether sequential reads are served from a single long-lived request, instead of
+// one request per Read call. A dropped stream is transparently reopened at the current offset.
+func (r *Reader) SetStreaming(enabled bool) {
+	r.streaming = enabled
+	if !enabled {
+		r.closeStream()
+	}
+}
+
+// Seek seeks to the given offset from the given mode, closing the stream if the offset changes
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	n, err := r.file.Seek(offset, whence)
+	if r.stream != nil && r.stream.offset != r.offset {
+		r.closeStream()
+	}
+	return n, err
+}
+
+// Close closes the stream, cancels the prefetches of the block cache and tells the server to close the remote file
+func (r *Reader) Close() error {
+	r.closeStream()
+	if r.cache != nil {
+		r.cache.close()
+	}
+	return r.close()
+}
+
+// WriteTo writes the remote file from the current offset up to its end to the writer using a single request.
+// When the request fails after making progress, it is transparently reopened at the current offset.
+// Readers with a block cache or parallel reads copy with ranged reads instead, so those keep being used.
+func (r *Reader) WriteTo(w io.Writer) (n int64, err error) {
+	r.closeStream()
+
+	if r.cache != nil || r.chunkSize > 0 {
+		bufSize := 32 * 1024
+		if r.chunkSize > 0 {
+			// Make every read large enough to be split over all parallel requests
+			bufSize = max(bufSize, r.chunkSize*r.parallelism)
+		}
+		// Hide WriteTo from io.CopyBuffer, so it reads through Read
+		return io.CopyBuffer(w, struct{ io.Reader }{r}, make([]byte, bufSize))
+	}
+
+	done := r.observe(OperationRead)
+	defer func() {
+		done(n, err)
+	}()
+
+	dst := &writeErrorRecorder{w: w}
+	attempts := 0
+	for {
+		body, err := r.openRange(r.ctx, r.offset, math.MaxInt64-r.offset)
+		if err != nil {
+			return n, err
+		}
+
+		copied, err := io.Copy(dst, body)
+		_ = body.Close()
+		n += copied
+		r.offset += copied
+		if err == nil {
+			return n, nil
+		}
+		if dst.err != nil || !r.reconnectable(err) {
+			return n, err
+		}
+
+		if copied > 0 {
+			attempts = 0
+		}
+		attempts++
+		if attempts > streamReconnects {
+			return n, err
+		}
+		r.logger.Debug("networkfile.Reader.WriteTo: Stream dropped, reconnecting",
+			"fileID", r.fileID, "offset", r.offset, "error", err)
+	}
+}
+
+// readStream reads from the stream, opening it when there is none at the current offset
+func (r *Reader) readStream(buf []byte) (n int, err error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		if r.stream == nil || r.stream.offset != r.offset {
+			r.closeStream()
+			done := r.observe(OperationRead)
+			body, err := r.openRange(r.ctx, r.offset, math.MaxInt64-r.offset)
+			if err != nil {
+				done(0, err)
+				return 0, err
+			}
+			r.stream = &readStream{
+				body:   body,
+				offset: r.offset,
+				done:   done,
+			}
+		}
+
+		n, err = r.stream.body.Read(buf)
+		r.offset += int64(n)
+		r.stream.offset = r.offset
+		r.stream.read += int64(n)
+		if err == nil {
+			return n, nil
+		}
+		r.stream.err = err
+
+		r.closeStream()
+		if errors.Is(err, io.EOF) {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, io.EOF
+		}
+		if n > 0 {
+			// The next read reconnects at the new offset
+			return n, nil
+		}
+		if attempt >= streamReconnects || !r.reconnectable(err) {
+			return 0, err
+		}
+		r.logger.Debug("networkfile.Reader.readStream: Stream dropped, reconnecting",
+			"fileID", r.fileID, "offset", r.offset, "error", err)
+	}
+}
+
+// reconnectable returns whether a stream failing with the given error may be reopened
+func (r *Reader) reconnectable(err error) bool {
+	return !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, ErrChecksumMismatch)
+}
+
+// closeStream closes the current stream, if any
+func (r *Reader) closeStream() {
+	if r.stream == nil {
+		return
+	}
+	_ = r.stream.body.Close()
+	r.stream.done(r.stream.read, r.stream.err)
+	r.stream = nil
+}
+
+// writeErrorRecorder records errors of the underlying writer, to tell them apart from read errors
+type writeErrorRecorder struct {
+	w   io.Writer
+	err error
+}
+
+// Write writes to the underlying writer
+func (w *writeErrorRecorder) Write(buf []byte) (int, error) {
+	n, err := w.w.Write(buf)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,126 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// abortingResponseWriter drops the connection after writing a limited amount of bytes
+type abortingResponseWriter struct {
+	http.ResponseWriter
+	remaining int
+}
+
+func (a *abortingResponseWriter) Write(buf []byte) (int, error) {
+	if len(buf) > a.remaining {
+		buf = buf[:a.remaining]
+	}
+	n, err := a.ResponseWriter.Write(buf)
+	a.remaining -= n
+	if a.remaining == 0 {
+		a.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	return n, err
+}
+
+// droppingServer drops the connection of the first ranged GET after the given amount of bytes
+func droppingServer(srv *FileServer, after int, requests *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet && req.Header.Get(HeaderRange) != "" {
+			if atomic.AddInt64(requests, 1) == 1 {
+				resp = &abortingResponseWriter{ResponseWriter: resp, remaining: after}
+			}
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+}
+
+func TestReaderStreaming(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := droppingServer(srv, 3000, &requests)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(10_000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.SetStreaming(true)
+
+	buf := make([]byte, 5000)
+	_, err = io.ReadFull(rdr, buf)
+	assert.NoError(t, err)
+	assert.EqualValues(t, srcBuf[:5000], buf)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&requests))
+
+	// Seeking to the current position keeps the stream
+	off, err := rdr.Seek(0, io.SeekCurrent)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5000, off)
+	_, err = io.ReadFull(rdr, buf[:1000])
+	assert.NoError(t, err)
+	assert.EqualValues(t, srcBuf[5000:6000], buf[:1000])
+	assert.EqualValues(t, 2, atomic.LoadInt64(&requests))
+
+	// Seeking away opens a new stream
+	_, err = rdr.Seek(100, io.SeekStart)
+	assert.NoError(t, err)
+	_, err = io.ReadFull(rdr, buf[:1000])
+	assert.NoError(t, err)
+	assert.EqualValues(t, srcBuf[100:1100], buf[:1000])
+	assert.EqualValues(t, 3, atomic.LoadInt64(&requests))
+
+	assert.NoError(t, rdr.Close())
+}
+
+func TestReaderWriteTo(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := droppingServer(srv, 40_000, &requests)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(100_000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	_, err = rdr.Seek(10, io.SeekStart)
+	assert.NoError(t, err)
+
+	dst := &bytes.Buffer{}
+	n, err := io.Copy(dst, rdr)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 99_990, n)
+	assert.EqualValues(t, srcBuf[10:], dst.Bytes())
+	assert.EqualValues(t, 2, atomic.LoadInt64(&requests))
+
+	assert.NoError(t, rdr.Close())
+}
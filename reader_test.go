@@ -1,6 +1,7 @@
 package networkfile
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -128,6 +130,55 @@ func TestReaderCopySingleCall(t *testing.T) {
 	assert.NoError(t, rdr.Close())
 }
 
+func TestReaderCopyRanged(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := countingServer(srv, &requests)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(100_000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	// Parallel reads keep splitting the copy into ranged requests
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.SetParallelReads(10_000, 4)
+	dst := &bytes.Buffer{}
+	n, err := io.Copy(dst, rdr)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 100_000, n)
+	assert.Equal(t, srcBuf, dst.Bytes())
+	assert.GreaterOrEqual(t, atomic.LoadInt64(&requests), int64(10))
+
+	// The block cache keeps serving the copy, so copying again needs no requests
+	atomic.StoreInt64(&requests, 0)
+	rdr = NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.EnableBlockCache(BlockCacheConfig{BlockSize: 40_000})
+	dst.Reset()
+	_, err = io.Copy(dst, rdr)
+	assert.NoError(t, err)
+	assert.Equal(t, srcBuf, dst.Bytes())
+	assert.EqualValues(t, 3, atomic.LoadInt64(&requests))
+
+	_, err = rdr.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	dst.Reset()
+	_, err = io.Copy(dst, rdr)
+	assert.NoError(t, err)
+	assert.Equal(t, srcBuf, dst.Bytes())
+	assert.EqualValues(t, 3, atomic.LoadInt64(&requests))
+	assert.NoError(t, rdr.Close())
+}
+
 func TestReaderSeek(t *testing.T) {
 	srv := NewFileServer(prefix, secret)
 	testServer := httptest.NewServer(srv)
@@ -323,3 +374,42 @@ func TestReaderLargeFile(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, 1337*1337*13, n)
 }
+
+func TestReaderParallelReadAt(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(1_000_003)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.SetParallelReads(64*1024, 4)
+
+	buf := make([]byte, 900_000)
+	n, err := rdr.ReadAt(buf, 50_000)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 900_000, n)
+	assert.EqualValues(t, srcBuf[50_000:950_000], buf)
+
+	n, err = rdr.ReadAt(buf, 500_000)
+	assert.Equal(t, io.EOF, err)
+	assert.EqualValues(t, 500_003, n)
+	assert.EqualValues(t, srcBuf[500_000:], buf[:n])
+
+	n, err = rdr.ReadAt(buf, 2_000_000)
+	assert.Equal(t, io.EOF, err)
+	assert.EqualValues(t, 0, n)
+
+	assert.NoError(t, rdr.Close())
+}
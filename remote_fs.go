@@ -0,0 +1,397 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+)
+
+// ListEntry describes a file served by a FileServer
+type ListEntry struct {
+	FileID FileID    `json:"id"`
+	Info   *FileInfo `json:"info,omitempty"` // Only set when the file can be statted
+}
+
+// List returns the files served for reading by the server, sorted by FileID.
+// The server has to allow listing, otherwise ErrUnsupportedOperation is returned.
+func (c *Client) List(ctx context.Context) ([]ListEntry, error) {
+	f := &file{}
+	c.initFile(ctx, f, "")
+	return f.list()
+}
+
+// list requests the list of served files from the server
+func (f *file) list() (entries []ListEntry, err error) {
+	done := f.observe(OperationList)
+	defer func() {
+		done(0, err)
+	}()
+
+	req, err := f.prepareRequest(http.MethodGet, f.baseURL+"/", nil) // nolint:noctx
+	if err != nil {
+		f.logger.Error("networkfile.File.list: Error creating request", "error", err)
+		return nil, err
+	}
+
+	resp, err := f.do(OperationList, req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			f.logger.Info("networkfile.File.list: Context expired", "error", err)
+		} else {
+			f.logger.Error("networkfile.File.list: Error executing request", "error", err)
+		}
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	err = responseCodeToError(resp, http.StatusOK)
+	if err != nil {
+		f.logger.Info("networkfile.File.list: A remote error occurred", "error", err)
+		return nil, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	if err != nil {
+		f.logger.Error("networkfile.File.list: Error decoding list", "error", err)
+		return nil, err
+	}
+
+	f.logger.Debug("networkfile.File.list: Listed files", "files", len(entries))
+	return entries, nil
+}
+
+// handleListFiles handles http requests to list the served readers the identity of the request may read
+func (fs *FileServer) handleListFiles(resp http.ResponseWriter, req *http.Request) {
+	if !fs.allowList {
+		writeErrorToResponseWriter(resp, ErrUnsupportedOperation)
+		return
+	}
+
+	fs.mu.RLock()
+	entries := make([]ListEntry, 0, len(fs.readers)+len(fs.fsFiles))
+	for fileID := range fs.readers {
+		entries = append(entries, ListEntry{FileID: fileID})
+	}
+	for fileID := range fs.fsFiles {
+		entries = append(entries, ListEntry{FileID: fileID})
+	}
+	fs.mu.RUnlock()
+
+	entries = slices.DeleteFunc(entries, func(entry ListEntry) bool {
+		return !fs.permits(req.Context(), entry.FileID, OperationRead)
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FileID < entries[j].FileID
+	})
+	for i := range entries {
+		if !fs.permits(req.Context(), entries[i].FileID, OperationStat) {
+			continue
+		}
+		info, err := fs.statFile(entries[i].FileID)
+		if err == nil {
+			entries[i].Info = &info
+		}
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		fs.logger.Error("networkfile.FileServer.handleListFiles: Error marshalling json", "error", err)
+		resp.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp.WriteHeader(http.StatusOK)
+	_, err = resp.Write(data)
+	if err != nil {
+		fs.logger.Error("networkfile.FileServer.handleListFiles: Error writing json", "error", err)
+	}
+}
+
+// RemoteFS is a read-only fs.FS of the files served by a FileServer. File names are mapped to
+// FileIDs with FileIDFromPath, so the file at "dir/file.txt" is the remote file "dir_file.txt".
+// The directory "." lists the served files when the server allows listing.
+type RemoteFS struct {
+	client *Client
+	ctx    context.Context
+}
+
+// NewRemoteFS creates a new RemoteFS opening files through the given client
+func NewRemoteFS(ctx context.Context, client *Client) *RemoteFS {
+	return &RemoteFS{
+		client: client,
+		ctx:    ctx,
+	}
+}
+
+// Open opens the named file for reading
+func (r *RemoteFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &remoteDir{fsys: r}, nil
+	}
+
+	info, err := r.stat(name)
+	if err != nil && !errors.Is(err, ErrUnsupportedOperation) && !errors.Is(err, ErrForbidden) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fsError(err)}
+	}
+	// A server not allowing stat, or not granting it to the client, may still allow reading the file
+	return &remoteFile{
+		rdr:     r.client.OpenReader(r.ctx, FileIDFromPath(name)),
+		info:    info,
+		statErr: err,
+	}, nil
+}
+
+// Stat returns the information of the named file
+func (r *RemoteFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return rootInfo(), nil
+	}
+
+	info, err := r.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fsError(err)}
+	}
+	return info, nil
+}
+
+// ReadFile reads the named file using a single request
+func (r *RemoteFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+
+	rdr := r.client.OpenReader(r.ctx, FileIDFromPath(name))
+	buf := &bytes.Buffer{}
+	_, err := rdr.WriteTo(buf)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fsError(err)}
+	}
+	return buf.Bytes(), nil
+}
+
+// ReadDir lists the served files, only the directory "." exists
+func (r *RemoteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries, err := r.client.List(r.ctx)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fsError(err)}
+	}
+
+	dirEntries := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		entryName, err := url.PathUnescape(string(entry.FileID))
+		if err != nil || !fs.ValidPath(entryName) || entryName == "." || FileIDFromPath(entryName) != entry.FileID {
+			// The file cannot be opened by name
+			continue
+		}
+		dirEntries = append(dirEntries, &remoteDirEntry{
+			fsys: r,
+			name: entryName,
+			info: entry.Info,
+		})
+	}
+	sort.Slice(dirEntries, func(i, j int) bool {
+		return dirEntries[i].Name() < dirEntries[j].Name()
+	})
+	return dirEntries, nil
+}
+
+// stat stats the remote file, reporting the base of the name as its name
+func (r *RemoteFS) stat(name string) (*FileInfo, error) {
+	f := &file{}
+	r.client.initFile(r.ctx, f, FileIDFromPath(name))
+	info, err := f.stat()
+	if err != nil {
+		return nil, err
+	}
+	info.FileName = path.Base(name)
+	return &info, nil
+}
+
+var errIsDir = errors.New("is a directory")
+
+// fsError translates remote errors to their io/fs equivalent
+func fsError(err error) error {
+	switch {
+	case errors.Is(err, ErrUnknownFile):
+		return fs.ErrNotExist
+	case errors.Is(err, ErrUnauthorized):
+		return fs.ErrPermission
+	}
+	return err
+}
+
+// rootInfo returns the information of the directory "."
+func rootInfo() *FileInfo {
+	return &FileInfo{
+		FileName:  ".",
+		FileMode:  fs.ModeDir | 0o555,
+		FileIsDir: true,
+	}
+}
+
+// remoteFile is a fs.File backed by a Reader
+type remoteFile struct {
+	rdr     *Reader
+	info    *FileInfo
+	statErr error // Why the information could not be retrieved when opening the file
+	closed  bool
+}
+
+// Stat returns the information retrieved when opening the file
+func (f *remoteFile) Stat() (fs.FileInfo, error) {
+	if f.info == nil {
+		return nil, &fs.PathError{Op: "stat", Path: string(f.rdr.fileID), Err: f.statErr}
+	}
+	return f.info, nil
+}
+
+// Read reads from the remote file
+func (f *remoteFile) Read(buf []byte) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	return f.rdr.Read(buf)
+}
+
+// ReadAt reads from the remote file at the given offset
+func (f *remoteFile) ReadAt(buf []byte, offset int64) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	return f.rdr.ReadAt(buf, offset)
+}
+
+// Seek seeks to the given offset from the given mode
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	return f.rdr.Seek(offset, whence)
+}
+
+// WriteTo writes the remote file from the current offset to the writer
+func (f *remoteFile) WriteTo(w io.Writer) (int64, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	return f.rdr.WriteTo(w)
+}
+
+// Close releases the file, the remote file stays served
+func (f *remoteFile) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	f.rdr.closeStream()
+	return nil
+}
+
+// remoteDir is the directory "." of a RemoteFS
+type remoteDir struct {
+	fsys    *RemoteFS
+	entries []fs.DirEntry
+	listed  bool
+	offset  int
+}
+
+// Stat returns the directory information
+func (d *remoteDir) Stat() (fs.FileInfo, error) {
+	return rootInfo(), nil
+}
+
+// Read always fails on a directory
+func (d *remoteDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: errIsDir}
+}
+
+// Close closes the directory
+func (d *remoteDir) Close() error {
+	return nil
+}
+
+// ReadDir returns the next count entries of the directory, or all remaining entries when count <= 0
+func (d *remoteDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fsys.ReadDir(".")
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.listed = true
+	}
+
+	remaining := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+	d.offset += count
+	return remaining[:count], nil
+}
+
+// remoteDirEntry is a listed remote file
+type remoteDirEntry struct {
+	fsys *RemoteFS
+	name string
+	info *FileInfo
+}
+
+// Name returns the name of the file
+func (e *remoteDirEntry) Name() string {
+	return e.name
+}
+
+// IsDir returns false, there are no subdirectories
+func (e *remoteDirEntry) IsDir() bool {
+	return false
+}
+
+// Type returns the type bits of the file
+func (e *remoteDirEntry) Type() fs.FileMode {
+	if e.info == nil {
+		return 0
+	}
+	return e.info.Mode().Type()
+}
+
+// Info returns the listed file information, or stats the file when the listing did not include it
+func (e *remoteDirEntry) Info() (fs.FileInfo, error) {
+	if e.info == nil {
+		return e.fsys.Stat(e.name)
+	}
+	info := *e.info
+	info.FileName = e.name
+	return &info, nil
+}
@@ -0,0 +1,130 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteFS(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.AllowList(true)
+	testServer := httptest.NewServer(srv)
+
+	contents := map[string][]byte{}
+	// fstest.TestFS reads every file many times in small pieces, each of which is a request, so keep them small
+	for _, name := range []string{"a.txt", "b.txt", "dir/c.txt"} {
+		src, err := randomFile(100)
+		assert.NoError(t, err)
+		defer func() {
+			_ = src.Close()
+			_ = os.Remove(src.Name())
+		}()
+		contents[name], err = io.ReadAll(src)
+		assert.NoError(t, err)
+
+		err = srv.ServeFileReader(context.Background(), FileIDFromPath(name), src)
+		assert.NoError(t, err)
+	}
+
+	client := NewClient(testServer.URL+prefix, WithSharedSecret(secret))
+	fsys := NewRemoteFS(context.Background(), client)
+
+	// Files in directories are listed by their FileID
+	assert.NoError(t, fstest.TestFS(fsys, "a.txt", "b.txt", "dir_c.txt"))
+
+	data, err := fs.ReadFile(fsys, "dir/c.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, contents["dir/c.txt"], data)
+
+	fi, err := fs.Stat(fsys, "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "a.txt", fi.Name())
+	assert.EqualValues(t, 100, fi.Size())
+
+	_, err = fsys.Open("missing.txt")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	// Closing a file keeps it served
+	f, err := fsys.Open("b.txt")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	_, err = f.Read(make([]byte, 10))
+	assert.ErrorIs(t, err, fs.ErrClosed)
+	data, err = fs.ReadFile(fsys, "b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, contents["b.txt"], data)
+}
+
+func TestRemoteFSListDisallowed(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	client := NewClient(testServer.URL+prefix, WithSharedSecret(secret))
+	_, err := client.List(context.Background())
+	assert.ErrorIs(t, err, ErrUnsupportedOperation)
+
+	_, err = fs.ReadDir(NewRemoteFS(context.Background(), client), ".")
+	assert.ErrorIs(t, err, ErrUnsupportedOperation)
+}
+
+func TestRemoteFSListGrants(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.AllowList(true)
+	srv.SetAuthenticator(AnyAuthenticator(
+		NewSharedSecretAuthenticator(secret),
+		NewBearerTokenAuthenticator(map[string]Identity{"customer-token": "customer"}),
+	))
+	srv.GrantOperations("customer", OperationList)
+	testServer := httptest.NewServer(srv)
+
+	err := srv.ServeFileReader(context.Background(), "public.txt", bytes.NewReader(make([]byte, 10)),
+		HandleGrant("customer", OperationRead))
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), "private.txt", bytes.NewReader(make([]byte, 10)))
+	assert.NoError(t, err)
+
+	// Only the files the identity may read are listed, without information it may not stat
+	customer := NewClient(testServer.URL+prefix, WithAuthProvider(BearerTokenAuth("customer-token")))
+	entries, err := customer.List(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []ListEntry{{FileID: "public.txt"}}, entries)
+
+	entries, err = NewClient(testServer.URL+prefix, WithSharedSecret(secret)).List(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.NotNil(t, entries[0].Info)
+}
+
+func TestRemoteFSOpenWithoutStatGrant(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.SetAuthenticator(NewBearerTokenAuthenticator(map[string]Identity{"customer-token": "customer"}))
+	testServer := httptest.NewServer(srv)
+
+	err := srv.ServeFileReader(context.Background(), "public.txt", bytes.NewReader([]byte("hello")),
+		HandleGrant("customer", OperationRead))
+	assert.NoError(t, err)
+
+	// The file is opened without its information when the identity may read but not stat it
+	client := NewClient(testServer.URL+prefix, WithAuthProvider(BearerTokenAuth("customer-token")))
+	fsys := NewRemoteFS(context.Background(), client)
+	f, err := fsys.Open("public.txt")
+	assert.NoError(t, err)
+	_, err = f.Stat()
+	assert.ErrorIs(t, err, ErrForbidden)
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.NoError(t, f.Close())
+
+	_, err = fsys.Stat("public.txt")
+	assert.ErrorIs(t, err, ErrForbidden)
+}
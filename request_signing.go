@@ -0,0 +1,251 @@
+package networkfile
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// HeaderSignature is the header carrying the signature of a signed request
+	HeaderSignature = "X-Signature"
+
+	// HeaderSignatureTimestamp is the header carrying the Unix time at which a request was signed
+	HeaderSignatureTimestamp = "X-Signature-Timestamp"
+
+	// HeaderSignatureNonce is the header carrying the random value that makes every signed request unique
+	HeaderSignatureNonce = "X-Signature-Nonce"
+
+	// HeaderContentSHA256 is the header carrying the hex encoded SHA-256 of the body of a signed request
+	HeaderContentSHA256 = "X-Content-SHA256"
+
+	// UnsignedPayload is sent as body digest of signed requests streaming a body that cannot be hashed in advance
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// DefaultSigningWindow is the default maximum difference between the signing time of a request and the server clock
+	DefaultSigningWindow = 5 * time.Minute
+
+	// DefaultNonceCacheSize is the default amount of nonces remembered to detect replayed requests
+	DefaultNonceCacheSize = 100_000
+)
+
+var (
+	errSignatureExpired   = errors.New("signature timestamp outside of signing window")
+	errSignatureInvalid   = errors.New("invalid signature")
+	errSignatureReplayed  = errors.New("replayed signature nonce")
+	errUnsignedPayload    = errors.New("unsigned payload not allowed")
+	errSignedBodyTooLarge = errors.New("signed body too large to verify")
+	errNonceCacheFull     = errors.New("too many signed requests within the signing window")
+)
+
+// signedHeaders are the headers changing what a request does, which are covered by its signature
+var signedHeaders = []string{
+	HeaderRange,
+	HeaderOperation,
+	HeaderSize,
+	HeaderContentEncoding,
+	HeaderIfMatch,
+	HeaderIfNoneMatch,
+	HeaderDigest,
+	HeaderWantDigest,
+	HeaderContentSHA256,
+	HeaderSignatureTimestamp,
+	HeaderSignatureNonce,
+}
+
+// RequestSigningAuth is an AuthProvider signing every request with a shared secret, instead of sending the secret.
+// The signature covers the method, path, query, the headers changing what the request does, body, time and a random
+// nonce of the request, so a request seen by an intermediary cannot be altered or sent again.
+type RequestSigningAuth string
+
+// Authorize signs the request
+func (s RequestSigningAuth) Authorize(req *http.Request) error {
+	digest, err := requestBodyDigest(req)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, 16)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Del(HeaderSharedSecret)
+	req.Header.Set(HeaderContentSHA256, digest)
+	req.Header.Set(HeaderSignatureTimestamp, strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set(HeaderSignatureNonce, base64.RawURLEncoding.EncodeToString(nonce))
+	req.Header.Set(HeaderSignature, requestSignature(string(s), req))
+	return nil
+}
+
+// requestBodyDigest returns the digest of the body of an outgoing request, without consuming the body
+func requestBodyDigest(req *http.Request) (string, error) {
+	h := sha256.New()
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+	case req.GetBody != nil:
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, body)
+		_ = body.Close()
+		if err != nil {
+			return "", err
+		}
+	default:
+		return UnsignedPayload, nil
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// requestSignature returns the base64 encoded HMAC of the signed parts of the request, keyed by the shared secret
+func requestSignature(sharedSecret string, req *http.Request) string {
+	parts := []string{
+		"networkfile signed request",
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+	}
+	for _, header := range signedHeaders {
+		parts = append(parts, req.Header.Get(header))
+	}
+
+	mac := hmac.New(sha256.New, []byte(sharedSecret))
+	_, _ = mac.Write([]byte(strings.Join(parts, "\n")))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// RequireSignedRequests sets whether clients must sign their requests, instead of sending the shared secret.
+// Requests authenticated by the authenticator without the shared secret, such as bearer tokens, are still accepted.
+func (fs *FileServer) RequireSignedRequests(require bool) {
+	fs.requireSigning = require
+}
+
+// SetSigningWindow sets the maximum difference between the signing time of a request and the server clock
+func (fs *FileServer) SetSigningWindow(window time.Duration) {
+	fs.signingWindow = window
+}
+
+// SetNonceCacheSize sets the amount of nonces remembered to detect replayed requests. When more signed requests
+// are received within the signing window, further signed requests are rejected with 429 Too Many Requests until
+// the oldest nonces expire.
+func (fs *FileServer) SetNonceCacheSize(size int) {
+	fs.nonces.mu.Lock()
+	defer fs.nonces.mu.Unlock()
+	fs.nonces.maxSize = size
+}
+
+// verifyRequestSignature checks the signature, timestamp and nonce of a signed request, and replaces
+// the body with a verified copy
+func (fs *FileServer) verifyRequestSignature(req *http.Request) error {
+	now := time.Now()
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderSignatureTimestamp), 10, 64)
+	if err != nil {
+		return errSignatureInvalid
+	}
+	signedAt := time.Unix(timestamp, 0)
+	if signedAt.Before(now.Add(-fs.signingWindow)) || signedAt.After(now.Add(fs.signingWindow)) {
+		return errSignatureExpired
+	}
+
+	valid := false
+	for _, secret := range fs.secrets.Secrets() {
+		// Anyone can sign with an empty secret, so it never verifies a signature
+		if secret == "" {
+			continue
+		}
+		if hmac.Equal([]byte(req.Header.Get(HeaderSignature)), []byte(requestSignature(secret, req))) {
+			valid = true
+		}
+	}
+	if !valid {
+		return errSignatureInvalid
+	}
+
+	// Only remember nonces of valid signatures, so the cache cannot be flushed by anyone without the secret
+	nonce := req.Header.Get(HeaderSignatureNonce)
+	if nonce == "" {
+		return errSignatureInvalid
+	}
+	err = fs.nonces.add(nonce, signedAt.Add(fs.signingWindow), now)
+	if err != nil {
+		return err
+	}
+
+	digest := req.Header.Get(HeaderContentSHA256)
+	if digest == UnsignedPayload {
+		// Only streamed writes cannot hash their body in advance
+		if req.Method != http.MethodPatch || !strings.HasSuffix(req.Header.Get(HeaderRange), "-"+OpenEndedLength) {
+			return errUnsignedPayload
+		}
+		return nil
+	}
+	if req.ContentLength < 0 {
+		return errSignatureInvalid
+	}
+	if req.ContentLength > fs.maxVerifiedChunk {
+		return errSignedBodyTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(req.Body, req.ContentLength))
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if !hmac.Equal([]byte(hex.EncodeToString(sum[:])), []byte(digest)) {
+		return errSignatureInvalid
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return nil
+}
+
+// nonceCache remembers the nonces of signed requests until their signatures expire
+type nonceCache struct {
+	maxSize int
+	expiry  map[string]time.Time
+	order   []string // Nonces in the order they were added, oldest first, starting at head
+	head    int      // Index of the oldest nonce in order that has not expired yet
+	mu      sync.Mutex
+}
+
+// add remembers the nonce until the given expiry. It returns errSignatureReplayed if the nonce was already seen, and
+// errNonceCacheFull if the cache is full of nonces that have not expired yet, which cannot be forgotten while they
+// could still be replayed.
+func (c *nonceCache) add(nonce string, expiry, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.head < len(c.order) && c.expiry[c.order[c.head]].Before(now) {
+		delete(c.expiry, c.order[c.head])
+		c.order[c.head] = ""
+		c.head++
+	}
+	if c.head > len(c.order)/2 {
+		// Copy the remaining nonces, so the backing array of the expired ones is freed
+		c.order = append(make([]string, 0, len(c.order)-c.head), c.order[c.head:]...)
+		c.head = 0
+	}
+
+	if _, ok := c.expiry[nonce]; ok {
+		return errSignatureReplayed
+	}
+	if c.maxSize <= 0 {
+		return nil
+	}
+	if len(c.order)-c.head >= c.maxSize {
+		return errNonceCacheFull
+	}
+	c.expiry[nonce] = expiry
+	c.order = append(c.order, nonce)
+	return nil
+}
@@ -0,0 +1,257 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestSigning(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.RequireSignedRequests(true)
+	var leaked int64
+	var captured *http.Request
+	testServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(HeaderSharedSecret) != "" {
+			atomic.AddInt64(&leaked, 1)
+		}
+		if captured == nil {
+			captured = req.Clone(context.Background())
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "signing-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = os.Remove(dst.Name())
+	}()
+	err = srv.ServeFile(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	client := NewClient(testServer.URL+prefix, WithRequestSigning(secret))
+	f := client.OpenFile(context.Background(), fileID)
+	_, err = f.WriteAt([]byte("hello world"), 0)
+	assert.NoError(t, err)
+	// Streamed writes send an unsigned payload
+	_, err = f.Writer().Seek(11, io.SeekStart)
+	assert.NoError(t, err)
+	_, err = f.Writer().ReadFrom(bytes.NewBufferString("!"))
+	assert.NoError(t, err)
+	buf := make([]byte, 12)
+	_, err = f.ReadAt(buf, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world!", string(buf))
+	fi, err := f.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 12, fi.Size())
+	assert.EqualValues(t, 0, atomic.LoadInt64(&leaked))
+
+	// Sending the shared secret is rejected
+	_, err = NewReader(context.Background(), testServer.URL+prefix, secret, fileID).Stat()
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	// The first request cannot be replayed
+	captured.RequestURI = ""
+	captured.URL.Scheme, captured.URL.Host = "http", testServer.Listener.Addr().String()
+	captured.Body = io.NopCloser(bytes.NewBufferString("hello world"))
+	resp, err := http.DefaultClient.Do(captured)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestRequestSigningVerification(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), fileID, bytes.NewReader(make([]byte, 100)))
+	assert.NoError(t, err)
+
+	request := func(sign func(req *http.Request)) int {
+		req, err := http.NewRequest(http.MethodGet, testServer.URL+prefix+"/"+string(fileID), nil)
+		assert.NoError(t, err)
+		req.Header.Set(HeaderRange, "0-10")
+		assert.NoError(t, RequestSigningAuth(secret).Authorize(req))
+		sign(req)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusPartialContent, request(func(req *http.Request) {}))
+	assert.Equal(t, http.StatusUnauthorized, request(func(req *http.Request) {
+		req.Header.Set(HeaderRange, "0-100")
+	}))
+	assert.Equal(t, http.StatusUnauthorized, request(func(req *http.Request) {
+		req.Header.Set(HeaderSignatureTimestamp, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+		req.Header.Set(HeaderSignature, requestSignature(secret, req))
+	}))
+	assert.Equal(t, http.StatusUnauthorized, request(func(req *http.Request) {
+		req.Header.Set(HeaderSignature, requestSignature("wrong", req))
+	}))
+}
+
+func TestRequestSigningTamperedHeaders(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "signing-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+	_, err = dst.Write(make([]byte, 100))
+	assert.NoError(t, err)
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	request := func(tamper func(req *http.Request)) int {
+		req, err := http.NewRequest(http.MethodPost, testServer.URL+prefix+"/"+string(fileID), nil)
+		assert.NoError(t, err)
+		req.Header.Set(HeaderOperation, string(OperationTruncate))
+		req.Header.Set(HeaderSize, "50")
+		assert.NoError(t, RequestSigningAuth(secret).Authorize(req))
+		tamper(req)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request(func(req *http.Request) {
+		req.Header.Set(HeaderSize, "0")
+	}))
+	assert.Equal(t, http.StatusUnauthorized, request(func(req *http.Request) {
+		req.Header.Set(HeaderOperation, string(OperationClose))
+	}))
+	assert.Equal(t, http.StatusUnauthorized, request(func(req *http.Request) {
+		req.Header.Set(HeaderIfMatch, "*")
+	}))
+	assert.Equal(t, http.StatusUnauthorized, request(func(req *http.Request) {
+		req.URL.RawQuery = "tampered=1"
+	}))
+	fi, err := dst.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 100, fi.Size())
+
+	assert.Equal(t, http.StatusNoContent, request(func(req *http.Request) {}))
+	fi, err = dst.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 50, fi.Size())
+}
+
+func TestRequestSigningRetry(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	// The first request reaches the server, which uses its nonce, but the response is lost
+	testServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt64(&requests, 1) == 1 {
+			srv.ServeHTTP(httptest.NewRecorder(), req)
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), fileID, bytes.NewReader(make([]byte, 100)))
+	assert.NoError(t, err)
+
+	client := NewClient(testServer.URL+prefix, WithRequestSigning(secret), WithRetryPolicy(testRetryPolicy()))
+	buf := make([]byte, 100)
+	_, err = client.OpenReader(context.Background(), fileID).ReadAt(buf, 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&requests))
+}
+
+func TestNonceCache(t *testing.T) {
+	cache := nonceCache{maxSize: 2, expiry: make(map[string]time.Time)}
+	now := time.Now()
+	assert.NoError(t, cache.add("a", now.Add(time.Minute), now))
+	assert.ErrorIs(t, cache.add("a", now.Add(time.Minute), now), errSignatureReplayed)
+	assert.NoError(t, cache.add("b", now.Add(time.Minute), now))
+
+	// Nonces that have not expired are never forgotten, so they cannot be replayed
+	assert.ErrorIs(t, cache.add("c", now.Add(time.Minute), now), errNonceCacheFull)
+	assert.ErrorIs(t, cache.add("a", now.Add(time.Minute), now), errSignatureReplayed)
+	assert.Len(t, cache.expiry, 2)
+
+	// Expired nonces are forgotten, along with the space they took
+	assert.NoError(t, cache.add("b", now.Add(2*time.Minute), now.Add(time.Hour)))
+	assert.Len(t, cache.expiry, 1)
+	assert.Equal(t, []string{"b"}, cache.order)
+	assert.Zero(t, cache.head)
+}
+
+func TestRequestSigningBodyTooLarge(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.SetMaxVerifiedChunkSize(10)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "signing-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	// Signed bodies are held in memory to verify them, so only bodies up to the maximum are accepted
+	write := func(data string) int {
+		req, err := http.NewRequest(http.MethodPatch, testServer.URL+prefix+"/"+string(fileID), strings.NewReader(data))
+		assert.NoError(t, err)
+		req.Header.Set(HeaderRange, fmt.Sprintf("0-%d", len(data)))
+		assert.NoError(t, RequestSigningAuth(secret).Authorize(req))
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusRequestEntityTooLarge, write("Hello, World!"))
+	assert.Equal(t, http.StatusNoContent, write("Hello"))
+
+	data, err := os.ReadFile(dst.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", string(data))
+}
+
+func TestRequestSigningEmptySecret(t *testing.T) {
+	srv := NewFileServer(prefix, "")
+	srv.SetAuthenticator(NewBearerTokenAuthenticator(map[string]Identity{"token-1": "service-1"}))
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), fileID, bytes.NewReader(make([]byte, 100)))
+	assert.NoError(t, err)
+
+	// A signature by the empty secret does not replace the credentials of the authenticator
+	_, err = NewClient(testServer.URL+prefix, WithRequestSigning("")).OpenReader(context.Background(), fileID).Stat()
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	_, err = NewClient(testServer.URL+prefix, WithAuthProvider(BearerTokenAuth("token-1"))).OpenReader(context.Background(), fileID).Stat()
+	assert.NoError(t, err)
+}
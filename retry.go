@@ -0,0 +1,153 @@
+package networkfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy determines whether and how failed requests of a Reader or Writer are retried
+type RetryPolicy struct {
+	MaxAttempts    int           // Maximum amount of attempts, including the first one
+	InitialBackoff time.Duration // Backoff before the first retry
+	MaxBackoff     time.Duration // Upper limit of the backoff between attempts
+	Multiplier     float64       // Factor by which the backoff grows after every attempt
+	Jitter         float64       // Fraction of the backoff that is randomised, between 0 and 1
+
+	// Retryable decides whether a failed attempt may be retried based on the response or the transport error.
+	// When nil, DefaultRetryable is used. Responses that map to an error in HTTPCodeToErr are never retried.
+	Retryable func(resp *http.Response, err error) bool
+}
+
+// DefaultRetryPolicy returns a retry policy with sensible defaults
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// DefaultRetryable retries transport errors other than an expired context,
+// and responses indicating a temporary problem with the server or a proxy in between.
+func DefaultRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// shouldRetry returns whether the given attempt may be retried
+func (p *RetryPolicy) shouldRetry(attempt int, resp *http.Response, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if err == nil {
+		if resp.StatusCode < 300 {
+			return false
+		}
+		if _, ok := HTTPCodeToErr[resp.StatusCode]; ok {
+			return false
+		}
+	}
+
+	if p.Retryable != nil {
+		return p.Retryable(resp, err)
+	}
+	return DefaultRetryable(resp, err)
+}
+
+// backoff returns how long to wait before the next attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (rand.Float64()*2 - 1) // nolint:gosec
+	}
+	return time.Duration(backoff)
+}
+
+// SetRetryPolicy sets the policy used to retry failed requests, nil disables retrying
+func (f *file) SetRetryPolicy(policy *RetryPolicy) {
+	f.retry = policy
+}
+
+// do executes the request, retrying it according to the retry policy
+func (f *file) do(op Operation, req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		err := f.authorize(req)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := f.client.Do(req)
+		if err == nil {
+			f.learnEncodings(resp)
+		}
+		if f.retry == nil || !f.retry.shouldRetry(attempt, resp, err) {
+			return resp, err
+		}
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			// The body cannot be sent again
+			return resp, err
+		}
+
+		backoff := f.retry.backoff(attempt)
+		ctx := req.Context()
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return resp, err
+		}
+
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			_ = resp.Body.Close()
+		}
+		f.logger.Debug("networkfile.File.do: Retrying request", "fileID", f.fileID, "method", req.Method,
+			"attempt", attempt, "backoff", backoff, "status", status, "error", err)
+
+		if f.observer != nil {
+			cause := err
+			if cause == nil {
+				cause = fmt.Errorf("unexpected status %d", status)
+			}
+			f.observer.RequestRetried(op, f.fileID, attempt, cause)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		next := req.Clone(ctx)
+		if req.GetBody != nil {
+			next.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+		req = next
+	}
+}
@@ -0,0 +1,128 @@
+package networkfile
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyServer fails the first failures requests with the given status code
+func flakyServer(srv *FileServer, failures int64, status int, requests *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt64(requests, 1) <= failures {
+			resp.WriteHeader(status)
+			return
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+}
+
+func testRetryPolicy() *RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	return policy
+}
+
+func TestReaderRetry(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := flakyServer(srv, 2, http.StatusServiceUnavailable, &requests)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(100)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	rdr.SetRetryPolicy(testRetryPolicy())
+
+	buf := make([]byte, 100)
+	n, err := rdr.Read(buf)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 100, n)
+	assert.EqualValues(t, 3, atomic.LoadInt64(&requests))
+
+	// EOF is a protocol error and must not be retried
+	n, err = rdr.Read(buf)
+	assert.Equal(t, io.EOF, err)
+	assert.EqualValues(t, 0, n)
+	assert.EqualValues(t, 4, atomic.LoadInt64(&requests))
+
+	assert.NoError(t, rdr.Close())
+}
+
+func TestWriterRetry(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := flakyServer(srv, 1, http.StatusBadGateway, &requests)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "writer-retry-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	wrtr.SetRetryPolicy(testRetryPolicy())
+
+	n, err := wrtr.Write([]byte("Hello, World!"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 13, n)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&requests))
+
+	_, err = dst.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	dstBuf, err := io.ReadAll(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello, World!", string(dstBuf))
+
+	assert.NoError(t, wrtr.Close())
+}
+
+func TestRetryUnauthorizedNotRetried(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := flakyServer(srv, 0, 0, &requests)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, "wrong", "test")
+	rdr.SetRetryPolicy(testRetryPolicy())
+
+	_, err := rdr.Read(make([]byte, 10))
+	assert.Equal(t, ErrUnauthorized, err)
+	assert.EqualValues(t, 1, atomic.LoadInt64(&requests))
+}
+
+func TestRetryExhausted(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := flakyServer(srv, 100, http.StatusServiceUnavailable, &requests)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, "test")
+	policy := testRetryPolicy()
+	policy.MaxAttempts = 3
+	rdr.SetRetryPolicy(policy)
+
+	_, err := rdr.Read(make([]byte, 10))
+	assert.Error(t, err)
+	assert.EqualValues(t, 3, atomic.LoadInt64(&requests))
+}
@@ -0,0 +1,131 @@
+package networkfile
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// File is a remote file served for both reading and writing by a FileServer, preferably with ServeFile.
+// Reads always see the writes made through the same File, so it does not pin the version of the remote file.
+type File struct {
+	rdr    *Reader
+	wrtr   *Writer
+	offset int64
+}
+
+// NewFile creates a new remote File for the given URL, shared secret and FileID
+func NewFile(ctx context.Context, baseURL, sharedSecret string, fileID FileID) *File {
+	return NewClient(baseURL, WithSharedSecret(sharedSecret)).OpenFile(ctx, fileID)
+}
+
+// OpenFile creates a new remote File for the given FileID
+func (c *Client) OpenFile(ctx context.Context, fileID FileID) *File {
+	rdr := c.OpenReader(ctx, fileID)
+	rdr.noPinning = true
+	return &File{
+		rdr:  rdr,
+		wrtr: c.OpenWriter(ctx, fileID),
+	}
+}
+
+// FileID returns the fileID
+func (f *File) FileID() FileID {
+	return f.wrtr.fileID
+}
+
+// Reader returns the Reader used for reading, for configuring it
+func (f *File) Reader() *Reader {
+	return f.rdr
+}
+
+// Writer returns the Writer used for writing, for configuring it
+func (f *File) Writer() *Writer {
+	return f.wrtr
+}
+
+// Read reads from the remote file
+func (f *File) Read(buf []byte) (n int, err error) {
+	n, err = f.ReadAt(buf, f.offset)
+	f.offset += int64(n)
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt reads from the remote file at a given offset, after flushing buffered writes
+func (f *File) ReadAt(buf []byte, offset int64) (n int, err error) {
+	err = f.wrtr.Flush()
+	if err != nil {
+		return 0, err
+	}
+	return f.rdr.ReadAt(buf, offset)
+}
+
+// Write writes to the remote file
+func (f *File) Write(buf []byte) (n int, err error) {
+	n, err = f.WriteAt(buf, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+// WriteAt writes to the remote file at a given offset
+func (f *File) WriteAt(buf []byte, offset int64) (n int, err error) {
+	n, err = f.wrtr.WriteAt(buf, offset)
+	if n > 0 {
+		// Our own writes make the cached blocks of the reader stale
+		f.rdr.ResetVersion()
+	}
+	return n, err
+}
+
+// Seek seeks to the given offset from the given mode, flushing buffered writes first when seeking from the end
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		f.offset = offset
+	case io.SeekCurrent:
+		f.offset += offset
+	case io.SeekEnd:
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		f.offset = fi.Size() + offset
+	default:
+		return 0, ErrUnsupportedOperation
+	}
+	return f.offset, nil
+}
+
+// Stat flushes buffered writes and returns the remote file information
+func (f *File) Stat() (os.FileInfo, error) {
+	return f.wrtr.Stat()
+}
+
+// Flush sends all buffered writes to the remote file
+func (f *File) Flush() error {
+	return f.wrtr.Flush()
+}
+
+// Truncate changes the size of the remote file, after flushing buffered writes
+func (f *File) Truncate(size int64) error {
+	err := f.wrtr.Truncate(size)
+	if err == nil {
+		f.rdr.ResetVersion()
+	}
+	return err
+}
+
+// Sync flushes buffered writes and tells the server to commit the remote file to stable storage
+func (f *File) Sync() error {
+	return f.wrtr.Sync()
+}
+
+// Close flushes buffered writes and tells the server to close the remote file
+func (f *File) Close() error {
+	f.rdr.closeStream()
+	return f.wrtr.Close()
+}
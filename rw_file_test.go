@@ -0,0 +1,207 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "file-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFile(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, srv.ServeFileReader(context.Background(), fileID, dst), ErrFileIDTaken)
+
+	f := NewFile(context.Background(), testServer.URL+prefix, secret, fileID)
+	f.Writer().EnableWriteBuffer(1024)
+
+	n, err := f.Write([]byte("hello world"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 11, n)
+
+	// Reads see buffered writes
+	buf := make([]byte, 5)
+	_, err = f.ReadAt(buf, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "world", string(buf))
+
+	_, err = f.WriteAt([]byte("HELLO"), 0)
+	assert.NoError(t, err)
+	off, err := f.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, off)
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "HELLO world", string(data))
+
+	off, err = f.Seek(-5, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 6, off)
+	_, err = f.Write([]byte("there!"))
+	assert.NoError(t, err)
+
+	fi, err := f.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 12, fi.Size())
+
+	assert.NoError(t, f.Truncate(5))
+	_, err = f.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	data, err = io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "HELLO", string(data))
+
+	assert.NoError(t, f.Close())
+	_, err = f.Stat()
+	assert.ErrorIs(t, err, ErrUnknownFile)
+
+	// The shared handle was closed once, along with the writer
+	_, err = dst.Stat()
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestFileConcurrent(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "file-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFile(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	const workers = 8
+	const size = 1000
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			f := NewFile(context.Background(), testServer.URL+prefix, secret, fileID)
+			expected := bytes.Repeat([]byte(fmt.Sprintf("%d", i)), size)
+			buf := make([]byte, size)
+			for j := 0; j < 10; j++ {
+				_, err := f.WriteAt(expected, int64(i*size))
+				assert.NoError(t, err)
+				_, err = f.ReadAt(buf, int64(i*size))
+				assert.NoError(t, err)
+				assert.Equal(t, expected, buf)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	fi, err := dst.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, workers*size, fi.Size())
+}
+
+func TestFileConcurrentShared(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "file-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFile(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	// Reads racing with the writes of other goroutines never fail on a changed version
+	f := NewFile(context.Background(), testServer.URL+prefix, secret, fileID)
+	const workers = 8
+	const size = 1000
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			expected := bytes.Repeat([]byte(fmt.Sprintf("%d", i)), size)
+			buf := make([]byte, size)
+			for j := 0; j < 10; j++ {
+				_, err := f.WriteAt(expected, int64(i*size))
+				assert.NoError(t, err)
+				_, err = f.ReadAt(buf, int64(i*size))
+				assert.NoError(t, err)
+				assert.Equal(t, expected, buf)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Empty(t, f.Reader().Version())
+	assert.NoError(t, f.Close())
+}
+
+// closeCounter counts the calls to Close of a served file
+type closeCounter struct {
+	io.ReadWriteSeeker
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestServeFileCloseIO(t *testing.T) {
+	testCases := []struct {
+		closeReaders, closeWriters bool
+		closed                     int
+	}{
+		{false, false, 0},
+		{true, false, 1},
+		{false, true, 1},
+		{true, true, 1},
+	}
+	for _, tc := range testCases {
+		srv := NewFileServer(prefix, secret)
+		srv.CloseIO(tc.closeReaders, tc.closeWriters)
+		testServer := httptest.NewServer(srv)
+
+		dst, err := os.CreateTemp(os.TempDir(), "file-close-test-")
+		assert.NoError(t, err)
+		file := &closeCounter{ReadWriteSeeker: dst}
+
+		// The shared handle is closed once, when either side is configured to close it
+		fileID, err := RandomFileID()
+		assert.NoError(t, err)
+		err = srv.ServeFile(context.Background(), fileID, file)
+		assert.NoError(t, err)
+		assert.NoError(t, NewFile(context.Background(), testServer.URL+prefix, secret, fileID).Close())
+		assert.Equal(t, tc.closed, file.closed, "closeReaders %v, closeWriters %v", tc.closeReaders, tc.closeWriters)
+
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+		testServer.Close()
+	}
+}
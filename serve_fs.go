@@ -0,0 +1,245 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+)
+
+// DefaultIdleTimeout is the default duration after which an idle file opened from a served fs.FS is closed
+const DefaultIdleTimeout = time.Minute
+
+// fsFile is a file of a served fs.FS, which is opened on first access and closed when idle
+type fsFile struct {
+	fsys       fs.FS
+	name       string
+	generation uint64
+	file       fs.File
+	rdr        *concurrentReadSeeker
+	active     int         // Amount of requests using the reader
+	timer      *time.Timer // Closes the file once it has been idle
+	removed    bool        // Whether the file is no longer served
+	mu         sync.Mutex
+}
+
+// SetIdleTimeout sets the duration after which an idle file opened from a served fs.FS is closed
+func (fs *FileServer) SetIdleTimeout(timeout time.Duration) {
+	fs.idleTimeout = timeout
+}
+
+// ServeFS makes all regular files in the given fs.FS available, under the FileID derived by FileIDFromPath
+// from their path joined to the given prefix. Files are opened on first access and closed after being idle for
+// the idle timeout. Files that cannot seek are read into memory when opened. Closing such a file only closes
+// its open handle, the file stays served until the context expires.
+func (fs *FileServer) ServeFS(ctx context.Context, prefix string, fsys fs.FS) error {
+	files := make(map[FileID]*fsFile)
+	err := fsWalk(fsys, func(name string) {
+		files[FileIDFromPath(path.Join(prefix, name))] = &fsFile{
+			fsys:       fsys,
+			name:       name,
+			generation: handleGenerations.Add(1),
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fileIDs := make([]FileID, 0, len(files))
+	for fileID := range files {
+		if fs.readers[fileID] != nil || fs.fsFiles[fileID] != nil {
+			return ErrFileIDTaken
+		}
+		fileIDs = append(fileIDs, fileID)
+	}
+	if !fs.withinFileLimit(fileIDs...) {
+		return ErrTooManyFiles
+	}
+	for fileID, file := range files {
+		fs.addServed(fileID)
+		fs.fsFiles[fileID] = file
+	}
+
+	go func() {
+		// Wait for the context to expire, then stop serving the files
+		<-ctx.Done()
+
+		fs.mu.Lock()
+		for fileID, file := range files {
+			if fs.fsFiles[fileID] == file {
+				delete(fs.fsFiles, fileID)
+				fs.removeServed(fileID)
+			}
+			file.remove(fs)
+		}
+		fs.mu.Unlock()
+		fs.logger.Debug("networkfile.FileServer.ServeFS: Context for file system expired", "prefix", prefix, "files", len(files))
+	}()
+	return nil
+}
+
+// fsWalk calls fn with the name of every regular file in the fs.FS
+func fsWalk(fsys fs.FS, fn func(name string)) error {
+	return fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			fn(name)
+		}
+		return nil
+	})
+}
+
+// acquireReader returns the served reader for the FileID, and a function to call once the reader is no longer used
+func (fs *FileServer) acquireReader(fileID FileID) (*concurrentReadSeeker, func(), error) {
+	fs.mu.RLock()
+	reader := fs.readers[fileID]
+	file := fs.fsFiles[fileID]
+	fs.mu.RUnlock()
+
+	if reader != nil {
+		return reader, func() {}, nil
+	}
+	if file == nil {
+		return nil, nil, ErrUnknownFile
+	}
+
+	reader, err := file.acquire(fs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, func() {
+		file.release(fs)
+	}, nil
+}
+
+// closeFSFile closes the open handle of a file of a served fs.FS, assumes a lock is held
+func (fs *FileServer) closeFSFile(fileID FileID) bool {
+	file := fs.fsFiles[fileID]
+	if file == nil {
+		return false
+	}
+
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	if file.active == 0 {
+		file.close(fs)
+	}
+	return true
+}
+
+// acquire opens the file if needed and marks it as in use
+func (f *fsFile) acquire(fs *FileServer) (*concurrentReadSeeker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.removed {
+		return nil, ErrUnknownFile
+	}
+	if f.rdr == nil {
+		err := f.open()
+		if err != nil {
+			fs.logger.Error("networkfile.FileServer.acquireReader: Error opening file", "name", f.name, "error", err)
+			return nil, err
+		}
+		fs.logger.Debug("networkfile.FileServer.acquireReader: Opened file", "name", f.name)
+	}
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	f.active++
+	return f.rdr, nil
+}
+
+// release marks the file as no longer in use, and closes it once it has been idle for the idle timeout
+func (f *fsFile) release(fs *FileServer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.active--
+	if f.active > 0 || f.rdr == nil {
+		return
+	}
+	if f.removed {
+		f.close(fs)
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(fs.idleTimeout, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.timer == timer && f.active == 0 {
+			f.close(fs)
+			fs.logger.Debug("networkfile.FileServer.release: Closed idle file", "name", f.name)
+		}
+	})
+	f.timer = timer
+}
+
+// remove marks the file as no longer served and closes it when it is not in use
+func (f *fsFile) remove(fs *FileServer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.removed = true
+	if f.active == 0 {
+		f.close(fs)
+	}
+}
+
+// open opens the file, reading it into memory if it cannot seek, assumes the lock is held
+func (f *fsFile) open() error {
+	file, err := f.fsys.Open(f.name)
+	if err != nil {
+		return err
+	}
+
+	rdr, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		_ = file.Close()
+		if err != nil {
+			return err
+		}
+		rdr = bytes.NewReader(data)
+		file = nil
+	}
+
+	f.file = file
+	f.rdr = &concurrentReadSeeker{
+		rdr:        rdr,
+		generation: f.generation,
+		lock:       &handleLock{},
+	}
+	f.rdr.rdrAt, _ = rdr.(io.ReaderAt)
+	return nil
+}
+
+// close closes the open file, if any, assumes the lock is held
+func (f *fsFile) close(fs *FileServer) {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	if f.file != nil {
+		err := f.file.Close()
+		if err != nil {
+			fs.logger.Error("networkfile.FileServer.close: Error closing file", "name", f.name, "error", err)
+		}
+	}
+	f.file = nil
+	f.rdr = nil
+}
+
+// stat returns the information of the file from the fs.FS
+func (f *fsFile) stat() (fs.FileInfo, error) {
+	return fs.Stat(f.fsys, f.name)
+}
@@ -0,0 +1,138 @@
+package networkfile
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingFS counts the files opened and closed
+type countingFS struct {
+	fs.FS
+	opened, closed int64
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	f, err := c.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&c.opened, 1)
+	return &countingFile{File: f, closed: &c.closed}, nil
+}
+
+func (c *countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(c.FS, name)
+}
+
+func (c *countingFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(c.FS, name)
+}
+
+type countingFile struct {
+	fs.File
+	closed *int64
+}
+
+func (c *countingFile) Seek(offset int64, whence int) (int64, error) {
+	return c.File.(io.Seeker).Seek(offset, whence)
+}
+
+func (c *countingFile) Close() error {
+	atomic.AddInt64(c.closed, 1)
+	return c.File.Close()
+}
+
+// streamFS hides the io.Seeker of the opened files
+type streamFS struct {
+	fs.FS
+}
+
+func (s streamFS) Open(name string) (fs.File, error) {
+	f, err := s.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ fs.File }{f}, nil
+}
+
+func (s streamFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.FS, name)
+}
+
+func TestServeFS(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.SetIdleTimeout(50 * time.Millisecond)
+	testServer := httptest.NewServer(srv)
+
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	fsys := &countingFS{FS: fstest.MapFS{
+		"index.html":     {Data: []byte("<html></html>"), ModTime: modTime},
+		"static/app.js":  {Data: []byte("console.log('hi')")},
+		"static/app.css": {Data: []byte("body {}")},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := srv.ServeFS(ctx, "site", fsys)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, atomic.LoadInt64(&fsys.opened))
+
+	// Registering the same files twice fails
+	assert.ErrorIs(t, srv.ServeFS(ctx, "site", fsys), ErrFileIDTaken)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, FileIDFromPath("site/static/app.js"))
+	data, err := io.ReadAll(rdr)
+	assert.NoError(t, err)
+	assert.Equal(t, "console.log('hi')", string(data))
+	assert.EqualValues(t, 1, atomic.LoadInt64(&fsys.opened))
+
+	// Stat comes from the file system without opening the file
+	rdr = NewReader(context.Background(), testServer.URL+prefix, secret, FileIDFromPath("site/index.html"))
+	fi, err := rdr.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 13, fi.Size())
+	assert.Equal(t, modTime, fi.ModTime())
+	assert.EqualValues(t, 1, atomic.LoadInt64(&fsys.opened))
+
+	// Idle files are closed and reopened on the next access
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&fsys.closed) == 1
+	}, time.Second, 10*time.Millisecond)
+	_, err = rdr.ReadAt(make([]byte, 6), 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&fsys.opened))
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		_, err := rdr.ReadAt(make([]byte, 6), 0)
+		return err == ErrUnknownFile
+	}, time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&fsys.closed))
+}
+
+func TestServeFSNonSeekable(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	err := srv.ServeFS(context.Background(), "", streamFS{fstest.MapFS{
+		"dir/file.txt": {Data: []byte("0123456789")},
+	}})
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, FileIDFromPath("dir/file.txt"))
+	buf := make([]byte, 4)
+	_, err = rdr.ReadAt(buf, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "6789", string(buf))
+	_, err = rdr.ReadAt(buf, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "2345", string(buf))
+}
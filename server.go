@@ -1,15 +1,21 @@
 package networkfile
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -48,35 +54,67 @@ func RandomSharedSecret(bytes int) (string, error) {
 // FileServer is an HTTP server that serves files as io.Readers or io.Writers
 type FileServer struct {
 	urlPrefix         string
-	sharedSecret      string
+	secrets           *SharedSecretAuthenticator
+	authenticator     Authenticator
 	readers           map[FileID]*concurrentReadSeeker
 	writers           map[FileID]*concurrentWriteSeeker
-	allowStat         bool // Allow disclosing the information of Stat()
-	allowClose        bool // Allow clients to close a reader/writer
-	allowFullGET      bool // Allow serving the file via a normal GET request
-	allowPUT          bool // Allow writing the file via a PUT requests
+	fsFiles           map[FileID]*fsFile
+	versions          map[FileID]cachedVersion
+	versionsMu        sync.Mutex
+	allowStat         bool  // Allow disclosing the information of Stat()
+	allowClose        bool  // Allow clients to close a reader/writer
+	allowFullGET      bool  // Allow serving the file via a normal GET request
+	allowPUT          bool  // Allow writing the file via a PUT requests
+	allowChecksums    bool  // Allow sending and verifying digests of chunks
+	maxVerifiedChunk  int64 // Maximum length of a written chunk that is held in memory to verify its digest
+	allowCompression  bool  // Allow compressing read chunks and decompressing written chunks
+	allowList         bool  // Allow listing the served readers
+	allowSecretInURL  bool  // Allow passing the shared secret as GET parameter
+	requireSigning    bool  // Reject requests passing the shared secret instead of a signature
+	signingWindow     time.Duration
+	nonces            nonceCache
+	grants            map[Identity]map[Operation]bool
+	requestHook       RequestHook
 	discloseFilenames bool // Allow disclosing filename via Stat()
 	closeReaders      bool // Attempt to detect io.Closer and close the io.ReaderAt.
 	closeWriters      bool // Attempt to detect io.Closer and close the io.WriterAt.
+	idleTimeout       time.Duration
+	limits            Limits
+	servedFiles       int           // Amount of distinct FileIDs served
+	requestSlots      chan struct{} // Taken by every request handled, when the amount of concurrent requests is limited
 	mu                sync.RWMutex
 	logger            *slog.Logger
 }
 
 // NewFileServer creates a new FileServer with a given shared secret
 func NewFileServer(urlPrefix, sharedSecret string) (fs *FileServer) {
+	secrets := NewSharedSecretAuthenticator(sharedSecret)
 	fs = &FileServer{
 		urlPrefix:         urlPrefix,
-		sharedSecret:      sharedSecret,
+		secrets:           secrets,
+		authenticator:     secrets,
 		readers:           make(map[FileID]*concurrentReadSeeker),
 		writers:           make(map[FileID]*concurrentWriteSeeker),
+		fsFiles:           make(map[FileID]*fsFile),
+		versions:          make(map[FileID]cachedVersion),
+		idleTimeout:       DefaultIdleTimeout,
+		signingWindow:     DefaultSigningWindow,
+		maxVerifiedChunk:  DefaultMaxVerifiedChunkSize,
 		allowStat:         true,
 		allowClose:        true,
 		allowFullGET:      true,
 		allowPUT:          true,
+		allowChecksums:    true,
+		allowCompression:  true,
+		allowSecretInURL:  true,
 		discloseFilenames: true,
 		closeReaders:      true,
 		closeWriters:      true,
 		logger:            slog.Default(),
+		nonces: nonceCache{
+			maxSize: DefaultNonceCacheSize,
+			expiry:  make(map[string]time.Time),
+		},
 	}
 
 	return fs
@@ -92,6 +130,12 @@ func (fs *FileServer) AllowStat(allow bool) {
 	fs.allowStat = allow
 }
 
+// AllowSecretInURL sets whether the shared secret may be passed as GET parameter, as done by FullReadURL and PutURL.
+// Disallow it when clients use signed URLs, which do not leak the shared secret into browser histories and logs.
+func (fs *FileServer) AllowSecretInURL(allow bool) {
+	fs.allowSecretInURL = allow
+}
+
 // AllowClose sets whether it is allowed to close a file by clients
 func (fs *FileServer) AllowClose(allow bool) {
 	fs.allowClose = allow
@@ -107,6 +151,21 @@ func (fs *FileServer) AllowPUT(allow bool) {
 	fs.allowPUT = allow
 }
 
+// AllowChecksums sets whether to send digests of read chunks and verify digests of written chunks when clients ask for it
+func (fs *FileServer) AllowChecksums(allow bool) {
+	fs.allowChecksums = allow
+}
+
+// AllowCompression sets whether to gzip compress read chunks and accept gzip compressed written chunks when clients ask for it
+func (fs *FileServer) AllowCompression(allow bool) {
+	fs.allowCompression = allow
+}
+
+// AllowList sets whether clients are allowed to list the FileIDs of all served readers
+func (fs *FileServer) AllowList(allow bool) {
+	fs.allowList = allow
+}
+
 // DiscloseFilenames sets whether the real filenames should be disclosed on Stat()
 func (fs *FileServer) DiscloseFilenames(disclose bool) {
 	fs.discloseFilenames = disclose
@@ -118,12 +177,16 @@ func (fs *FileServer) CloseIO(closeReaders, closeWriters bool) {
 	fs.closeWriters = closeWriters
 }
 
-// SharedSecret returns the shared secret
+// SharedSecret returns the first of the shared secrets
 func (fs *FileServer) SharedSecret() string {
-	return fs.sharedSecret
+	secrets := fs.secrets.Secrets()
+	if len(secrets) == 0 {
+		return ""
+	}
+	return secrets[0]
 }
 
-// ServeHTTP is called for each incoming http request and handles the routing and sharedSecret check
+// ServeHTTP is called for each incoming http request and handles the routing and authentication
 func (fs *FileServer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	if fs.urlPrefix != "" && !strings.HasPrefix(req.URL.Path, fs.urlPrefix) {
 		fs.logger.Debug("networkfile.FileServer.ServeHTTP: Invalid URL prefix",
@@ -132,16 +195,39 @@ func (fs *FileServer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	secret := req.Header.Get(HeaderSharedSecret)
-	if secret == "" {
-		secret = req.URL.Query().Get(GETSharedSecret)
-	}
-	if secret != fs.sharedSecret {
-		fs.logger.Debug("networkfile.FileServer.ServeHTTP: Invalid secret")
-		resp.WriteHeader(http.StatusUnauthorized)
+	identity, ok := fs.authenticate(resp, req)
+	if !ok {
 		return
 	}
 
+	// Only authenticated requests take a slot, so unauthenticated clients cannot keep others out
+	if slots := fs.requestSlots; slots != nil {
+		select {
+		case slots <- struct{}{}:
+			defer func() {
+				<-slots
+			}()
+		default:
+			fs.logger.Debug("networkfile.FileServer.ServeHTTP: Too many concurrent requests",
+				"url", req.URL.Path, "max", fs.limits.MaxConcurrentRequests)
+			resp.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), identityContextKey{}, identity))
+	fs.logger.Debug("networkfile.FileServer.ServeHTTP: Authenticated request",
+		"identity", identity, "method", req.Method, "url", req.URL.Path)
+	if fs.requestHook != nil {
+		err := fs.requestHook(req)
+		if err != nil {
+			fs.logger.Debug("networkfile.FileServer.ServeHTTP: Request rejected by hook",
+				"identity", identity, "method", req.Method, "url", req.URL.Path, "error", err)
+			writeErrorToResponseWriter(resp, err)
+			return
+		}
+	}
+
 	url := strings.TrimPrefix(req.URL.Path, fs.urlPrefix)
 	// The expected URL format is /:fileID here.
 	if url[:1] != "/" {
@@ -150,16 +236,33 @@ func (fs *FileServer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if fs.allowCompression {
+		resp.Header().Set(HeaderAcceptEncoding, EncodingGzip)
+	}
+
 	fileID := FileID(url[1:])
+	if !fs.permits(req.Context(), fileID, requestOperation(req, fileID)) {
+		fs.logger.Debug("networkfile.FileServer.ServeHTTP: Operation not granted",
+			"identity", identity, "fileID", fileID, "operation", requestOperation(req, fileID))
+		writeErrorToResponseWriter(resp, ErrForbidden)
+		return
+	}
+
 	switch req.Method {
 	case http.MethodOptions:
-		fs.handleFileOptions(resp, fileID)
+		fs.handleFileOptions(resp, req, fileID)
 	case http.MethodGet:
+		if fileID == "" {
+			fs.handleListFiles(resp, req)
+			return
+		}
 		fs.handleReadFile(resp, req, fileID)
 	case http.MethodPatch:
 		fs.handleWriteFile(resp, req, fileID)
 	case http.MethodPut:
 		fs.handleFullWriteFile(resp, req, fileID)
+	case http.MethodPost:
+		fs.handleOperation(resp, req, fileID)
 	case http.MethodDelete:
 		fs.handleCloseFile(resp, fileID)
 	default:
@@ -168,44 +271,136 @@ func (fs *FileServer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	}
 }
 
-// ServeFileReader makes the given Reader available under the given FileID
-func (fs *FileServer) ServeFileReader(ctx context.Context, fileID FileID, file io.ReadSeeker) error {
+// ServeFileReader makes the given Reader available under the given FileID, with the access policy of the options.
+// Readers that also implement io.ReaderAt, such as *os.File, are read concurrently with positional reads.
+func (fs *FileServer) ServeFileReader(ctx context.Context, fileID FileID, file io.ReadSeeker, opts ...HandleOption) error {
+	reader := &concurrentReadSeeker{
+		rdr:    file,
+		policy: newHandlePolicy(opts),
+	}
+	reader.rdrAt, _ = file.(io.ReaderAt)
+	return fs.serveReader(ctx, fileID, reader)
+}
+
+// ServeFileReaderAt makes the given ReaderAt available under the given FileID, it is read concurrently with positional reads
+func (fs *FileServer) ServeFileReaderAt(ctx context.Context, fileID FileID, file io.ReaderAt, opts ...HandleOption) error {
+	return fs.serveReader(ctx, fileID, &concurrentReadSeeker{
+		rdrAt:  file,
+		policy: newHandlePolicy(opts),
+	})
+}
+
+// serveReader makes the reader available under the given FileID until the context expires
+func (fs *FileServer) serveReader(ctx context.Context, fileID FileID, reader *concurrentReadSeeker) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
-	if fs.readers[fileID] != nil {
+	if fs.readers[fileID] != nil || fs.fsFiles[fileID] != nil {
 		return ErrFileIDTaken
 	}
-
-	// Make sure we start at offset 0
-	_, err := file.Seek(0, io.SeekStart)
-	if err != nil {
-		return err
+	if !fs.withinFileLimit(fileID) {
+		return ErrTooManyFiles
 	}
 
-	fs.readers[fileID] = &concurrentReadSeeker{
-		rdr: file,
+	if reader.rdr != nil {
+		// Make sure we start at offset 0
+		_, err := reader.rdr.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
 	}
 
+	reader.generation = handleGenerations.Add(1)
+	reader.registered = time.Now()
+	reader.lock = &handleLock{}
+	fs.addServed(fileID)
+	fs.readers[fileID] = reader
+
 	go func() {
 		// Wait for the context to expire, then close the reader if it hasnt been already
 		<-ctx.Done()
 
 		fs.mu.Lock()
 		if fs.closeReader(fileID) {
-			fs.logger.Debug("networkfile.FileServer.ServeFileReader: Context for file reader expired", "fileID", fileID)
+			fs.logger.Debug("networkfile.FileServer.serveReader: Context for file reader expired", "fileID", fileID)
 		}
 		fs.mu.Unlock()
 	}()
 	return nil
 }
 
-// ServeFileWriter makes the given Writer available under the given FileID
-func (fs *FileServer) ServeFileWriter(ctx context.Context, fileID FileID, file io.WriteSeeker) error {
+// ServeFileWriter makes the given Writer available under the given FileID, with the access policy of the options.
+// Writers that also implement io.WriterAt, such as *os.File, are written concurrently with positional writes, while
+// writes to overlapping ranges are applied one at a time. Writers refusing positional writes, such as files opened
+// with O_APPEND, are written by seeking under a lock instead.
+func (fs *FileServer) ServeFileWriter(ctx context.Context, fileID FileID, file io.WriteSeeker, opts ...HandleOption) error {
+	writer := &concurrentWriteSeeker{
+		wrtr:   file,
+		policy: newHandlePolicy(opts),
+	}
+	writer.wrtrAt = positionalWriter(file)
+	return fs.serveWriter(ctx, fileID, writer)
+}
+
+// ServeFileWriterAt makes the given WriterAt available under the given FileID, it is written concurrently with positional
+// writes, while writes to overlapping ranges are applied one at a time
+func (fs *FileServer) ServeFileWriterAt(ctx context.Context, fileID FileID, file io.WriterAt, opts ...HandleOption) error {
+	return fs.serveWriter(ctx, fileID, &concurrentWriteSeeker{
+		wrtrAt: file,
+		policy: newHandlePolicy(opts),
+	})
+}
+
+// serveWriter makes the writer available under the given FileID until the context expires
+func (fs *FileServer) serveWriter(ctx context.Context, fileID FileID, writer *concurrentWriteSeeker) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 	if fs.writers[fileID] != nil {
 		return ErrFileIDTaken
 	}
+	if !fs.withinFileLimit(fileID) {
+		return ErrTooManyFiles
+	}
+
+	if writer.wrtr != nil {
+		// Make sure we start at offset 0
+		_, err := writer.wrtr.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.generation = handleGenerations.Add(1)
+	writer.registered = time.Now()
+	writer.lock = &handleLock{}
+	fs.addServed(fileID)
+	fs.writers[fileID] = writer
+
+	go func() {
+		// Wait for the context to expire, then close the writer if it hasnt been already
+		<-ctx.Done()
+
+		fs.mu.Lock()
+		if fs.closeWriter(fileID) {
+			fs.logger.Debug("networkfile.FileServer.serveWriter: Context for file writer expired", "fileID", fileID)
+		}
+		fs.mu.Unlock()
+	}()
+
+	return nil
+}
+
+// ServeFile makes the given file available for both reading and writing under the given FileID.
+// Reads and writes share a single lock, so they never interleave their seeks. Files implementing
+// io.ReaderAt and io.WriterAt, such as *os.File, are read and written concurrently with positional IO instead.
+func (fs *FileServer) ServeFile(ctx context.Context, fileID FileID, file io.ReadWriteSeeker, opts ...HandleOption) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.readers[fileID] != nil || fs.writers[fileID] != nil || fs.fsFiles[fileID] != nil {
+		return ErrFileIDTaken
+	}
+	if !fs.withinFileLimit(fileID) {
+		return ErrTooManyFiles
+	}
 
 	// Make sure we start at offset 0
 	_, err := file.Seek(0, io.SeekStart)
@@ -213,67 +408,110 @@ func (fs *FileServer) ServeFileWriter(ctx context.Context, fileID FileID, file i
 		return err
 	}
 
-	fs.writers[fileID] = &concurrentWriteSeeker{
-		wrtr: file,
-	}
+	lock := &handleLock{shared: true}
+	generation := handleGenerations.Add(1)
+	policy := newHandlePolicy(opts)
+	reader := &concurrentReadSeeker{
+		rdr:        file,
+		generation: generation,
+		registered: time.Now(),
+		policy:     policy,
+		lock:       lock,
+	}
+	reader.rdrAt, _ = file.(io.ReaderAt)
+	writer := &concurrentWriteSeeker{
+		wrtr:       file,
+		generation: generation,
+		registered: reader.registered,
+		policy:     policy,
+		lock:       lock,
+	}
+	writer.wrtrAt = positionalWriter(file)
+	fs.addServed(fileID)
+	fs.readers[fileID] = reader
+	fs.writers[fileID] = writer
 
 	go func() {
-		// Wait for the context to expire, then close the writer if it hasnt been already
+		// Wait for the context to expire, then close the file if it hasnt been already
 		<-ctx.Done()
 
 		fs.mu.Lock()
-		if fs.closeWriter(fileID) {
-			fs.logger.Debug("networkfile.FileServer.ServeFileWriter: Context for file writer expired", "fileID", fileID)
+		closedReader := fs.closeReader(fileID)
+		closedWriter := fs.closeWriter(fileID)
+		if closedReader || closedWriter {
+			fs.logger.Debug("networkfile.FileServer.ServeFile: Context for file expired", "fileID", fileID)
 		}
 		fs.mu.Unlock()
 	}()
-
 	return nil
 }
 
 // statFile attempts to stat the opened reader/writer to retrieve file information
 func (fs *FileServer) statFile(fileID FileID) (FileInfo, error) {
-	if !fs.allowStat {
+	if !fs.allowed(fileID, OperationStat, func(p *handlePolicy) *bool { return p.allowStat }, fs.allowStat) {
 		return FileInfo{}, ErrUnsupportedOperation
 	}
 
+	fi, err := fs.statHandle(fileID)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	info := GetFileInfo(fi)
+	if !fs.discloseFilenames {
+		info.FileName = string(fileID)
+	}
+	return info, nil
+}
+
+// statHandle stats the opened reader/writer, or the file of a served fs.FS
+func (fs *FileServer) statHandle(fileID FileID) (os.FileInfo, error) {
 	var handle interface{}
+	var lock *handleLock
 	fs.mu.RLock()
+	fsFile := fs.fsFiles[fileID]
 	reader := fs.readers[fileID]
+	writer := fs.writers[fileID]
+	fs.mu.RUnlock()
 	if reader != nil {
-		handle = reader.rdr
-	}
-	if handle == nil {
-		writer := fs.writers[fileID]
-		if writer != nil {
-			handle = writer.wrtr
-		}
+		handle, lock = reader.handle(), reader.lock
+	} else if writer != nil {
+		handle, lock = writer.handle(), writer.lock
 	}
-	fs.mu.RUnlock()
 
-	if handle == nil {
-		return FileInfo{}, ErrUnknownFile
+	if handle == nil && fsFile == nil {
+		return nil, ErrUnknownFile
 	}
 
-	file, ok := handle.(Statter)
-	if !ok {
-		return FileInfo{}, ErrUnsupportedOperation
+	var fi os.FileInfo
+	var err error
+	if handle == nil {
+		fi, err = fsFile.stat()
+	} else {
+		file, ok := handle.(Statter)
+		if !ok {
+			return synthesizeStat(fileID, reader, writer)
+		}
+		// Positional reads and writes do not take the lock, so statting in between them gains nothing
+		positional := (reader == nil || reader.rdrAt != nil) && (writer == nil || writer.wrtrAt != nil)
+		if positional {
+			fi, err = file.Stat()
+		} else {
+			// Stat in between reads and writes, so the information is consistent with them
+			lock.mu.Lock()
+			fi, err = file.Stat()
+			lock.mu.Unlock()
+		}
 	}
-	fi, err := file.Stat()
 	if err != nil {
-		fs.logger.Error("networkfile.FileServer.statFile: Error statting handle", "fileID", fileID, "error", err)
-		return FileInfo{}, err
-	}
-
-	info := GetFileInfo(fi)
-	if !fs.discloseFilenames {
-		info.FileName = string(fileID)
+		fs.logger.Error("networkfile.FileServer.statHandle: Error statting handle", "fileID", fileID, "error", err)
+		return nil, err
 	}
-	return info, nil
+	return fi, nil
 }
 
 // handleFileOptions handles stat requests from the remote reader/writer
-func (fs *FileServer) handleFileOptions(resp http.ResponseWriter, fileID FileID) {
+func (fs *FileServer) handleFileOptions(resp http.ResponseWriter, req *http.Request, fileID FileID) {
 	info, err := fs.statFile(fileID)
 	if err != nil {
 		fs.logger.Debug("networkfile.FileServer.handleFileOptions: Error statting reader", "error", err)
@@ -281,6 +519,12 @@ func (fs *FileServer) handleFileOptions(resp http.ResponseWriter, fileID FileID)
 		return
 	}
 
+	version, _ := fs.fileVersion(fileID)
+	resp.Header().Set(HeaderETag, version)
+	if !fs.checkPreconditions(resp, req, version) {
+		return
+	}
+
 	resp.WriteHeader(http.StatusOK)
 	resp.Header().Set(HeaderContentLength, fmt.Sprintf("%d", info.FileSize))
 
@@ -325,21 +569,40 @@ func (fs *FileServer) requestOffsetAndLength(resp http.ResponseWriter, req *http
 	return offset, length, true
 }
 
+// requestOffset retrieves the offset of open-ended write requests
+func (fs *FileServer) requestOffset(resp http.ResponseWriter, req *http.Request) (offset int64, ok bool) {
+	byteRange := req.Header.Get(HeaderRange)
+
+	offset, err := strconv.ParseInt(strings.TrimSuffix(byteRange, "-"+OpenEndedLength), 10, 64)
+	if err != nil || offset < 0 {
+		fs.logger.Debug("networkfile.FileServer.requestOffset: Invalid offset in range header",
+			"byteRange", byteRange, "error", err)
+		resp.WriteHeader(http.StatusBadRequest)
+		_, _ = resp.Write([]byte("invalid offset"))
+		return 0, false
+	}
+	return offset, true
+}
+
 // handleReadFile handles read http requests from the remote reader
 func (fs *FileServer) handleReadFile(resp http.ResponseWriter, req *http.Request, fileID FileID) {
-	fs.mu.RLock()
-	reader := fs.readers[fileID]
-	fs.mu.RUnlock()
-
-	if reader == nil {
-		resp.WriteHeader(http.StatusNotFound)
+	reader, release, err := fs.acquireReader(fileID)
+	if err != nil {
+		writeErrorToResponseWriter(resp, err)
 		return
 	}
+	defer release()
+
+	version, _ := fs.fileVersion(fileID)
+	resp.Header().Set(HeaderETag, version)
 
-	if fs.allowFullGET && req.Header.Get(HeaderRange) == "" {
+	allowFullGET := fs.allowed(fileID, OperationRead, func(p *handlePolicy) *bool { return p.allowFullGET }, fs.allowFullGET)
+	if allowFullGET && req.Header.Get(HeaderRange) == "" {
 		// If the special range header is not set, treat it like a normal GET request
-		// Serve the file with the Go http handler to support partial requests
-		http.ServeContent(resp, req, string(fileID), time.Now(), reader.newReadSeeker())
+		fs.serveFullFile(resp, req, fileID, reader)
+		return
+	}
+	if !fs.checkPreconditions(resp, req, version) {
 		return
 	}
 
@@ -348,10 +611,25 @@ func (fs *FileServer) handleReadFile(resp http.ResponseWriter, req *http.Request
 		return
 	}
 
+	var digest hash.Hash
+	algo := DigestAlgorithm(req.Header.Get(HeaderWantDigest))
+	if fs.allowChecksums && algo != "" {
+		digest, ok = algo.newHash()
+		if ok {
+			// The digest is only known once the body is written, so it is sent as a trailer
+			resp.Header().Set("Trailer", HeaderDigest)
+		}
+	}
+
+	compress := fs.allowCompression && acceptsEncoding(req.Header.Get(HeaderAcceptEncoding), EncodingGzip)
+	if compress {
+		resp.Header().Set(HeaderContentEncoding, EncodingGzip)
+	}
+
 	resp.WriteHeader(http.StatusPartialContent)
 
 	rdr := reader.newReadSeeker()
-	_, err := rdr.Seek(offset, io.SeekStart)
+	_, err = rdr.Seek(offset, io.SeekStart)
 	if err != nil {
 		fs.logger.Error("networkfile.FileServer.handleReadFile: Error seeking to offset",
 			"offset", offset, "error", err)
@@ -359,19 +637,73 @@ func (fs *FileServer) handleReadFile(resp http.ResponseWriter, req *http.Request
 		return
 	}
 
-	n, err := io.Copy(resp, io.LimitReader(rdr, length))
+	var dst io.Writer = resp
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(resp)
+		dst = gz
+	}
+	if digest != nil {
+		// The digest is calculated over the uncompressed data
+		dst = io.MultiWriter(dst, digest)
+	}
+
+	n, err := io.Copy(dst, io.LimitReader(rdr, length))
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
 	if err != nil && !errors.Is(err, io.EOF) {
 		fs.logger.Debug("networkfile.FileServer.handleReadFile: Error copying to response",
 			"fileID", fileID, "error", err)
 		return
 	}
 
+	if digest != nil {
+		resp.Header().Set(HeaderDigest, formatDigest(algo, digest.Sum(nil)))
+	}
+
 	fs.logger.Debug("networkfile.FileServer.handleReadFile: Read bytes", "bytes", n, "offset", offset, "fileID", fileID, "error", err)
 }
 
+// serveFullFile serves the complete file with the Go http handler to support partial and conditional requests.
+// Positional readers of unknown size are streamed as a whole instead.
+func (fs *FileServer) serveFullFile(resp http.ResponseWriter, req *http.Request, fileID FileID, reader *concurrentReadSeeker) {
+	if reader.rdrAt == nil {
+		http.ServeContent(resp, req, string(fileID), time.Now(), reader.newReadSeeker())
+		return
+	}
+
+	fi, err := fs.statHandle(fileID)
+	if err == nil {
+		http.ServeContent(resp, req, string(fileID), time.Now(), io.NewSectionReader(reader.rdrAt, 0, fi.Size()))
+		return
+	}
+	if reader.rdr != nil {
+		http.ServeContent(resp, req, string(fileID), time.Now(), &readSeeker{parent: reader})
+		return
+	}
+
+	resp.WriteHeader(http.StatusOK)
+	n, err := io.Copy(resp, reader.newReadSeeker())
+	if err != nil {
+		fs.logger.Debug("networkfile.FileServer.serveFullFile: Error copying to response", "fileID", fileID, "error", err)
+		return
+	}
+	fs.logger.Debug("networkfile.FileServer.serveFullFile: Read bytes", "bytes", n, "fileID", fileID)
+}
+
 // handleWriteFile handles write http requests from the remote writer
 func (fs *FileServer) handleWriteFile(resp http.ResponseWriter, req *http.Request, fileID FileID) {
-	offset, length, ok := fs.requestOffsetAndLength(resp, req)
+	var offset, length int64
+	var ok bool
+	openEnded := strings.HasSuffix(req.Header.Get(HeaderRange), "-"+OpenEndedLength)
+	if openEnded {
+		// The body is streamed with an unknown length
+		offset, ok = fs.requestOffset(resp, req)
+		length = -1
+	} else {
+		offset, length, ok = fs.requestOffsetAndLength(resp, req)
+	}
 	if !ok {
 		return
 	}
@@ -385,23 +717,101 @@ func (fs *FileServer) handleWriteFile(resp http.ResponseWriter, req *http.Reques
 		return
 	}
 
+	if req.Header.Get(HeaderIfMatch) != "" || req.Header.Get(HeaderIfNoneMatch) != "" {
+		version, _ := fs.fileVersion(fileID)
+		if !fs.checkPreconditions(resp, req, version) {
+			return
+		}
+	}
+
+	var body io.Reader = req.Body
+	switch req.Header.Get(HeaderContentEncoding) {
+	case "", "identity":
+	case EncodingGzip:
+		if !fs.allowCompression {
+			resp.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			fs.logger.Debug("networkfile.FileServer.handleWriteFile: Error decompressing body", "fileID", fileID, "error", err)
+			resp.WriteHeader(http.StatusBadRequest)
+			_, _ = resp.Write([]byte("invalid gzip body"))
+			return
+		}
+		body = gz
+		if !openEnded {
+			// Never decompress more than one byte beyond the expected length
+			body = io.LimitReader(gz, length+1)
+		}
+	default:
+		resp.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	digest := req.Header.Get(HeaderDigest)
+	if openEnded {
+		// Streamed bodies cannot be verified before they are written
+		digest = ""
+	}
+	if fs.allowChecksums && digest != "" {
+		if length > fs.maxVerifiedChunk {
+			fs.logger.Debug("networkfile.FileServer.handleWriteFile: Chunk too large to verify",
+				"fileID", fileID, "length", length, "max", fs.maxVerifiedChunk)
+			resp.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		// Verify the complete body before anything is written
+		data, err := io.ReadAll(io.LimitReader(body, length+1))
+		if err != nil {
+			fs.logger.Debug("networkfile.FileServer.handleWriteFile: Error reading body", "fileID", fileID, "error", err)
+			writeErrorToResponseWriter(resp, err)
+			return
+		}
+		err = verifyDigest(digest, data)
+		if err != nil {
+			fs.logger.Info("networkfile.FileServer.handleWriteFile: Invalid digest",
+				"fileID", fileID, "offset", offset, "digest", digest, "error", err)
+			writeErrorToResponseWriter(resp, err)
+			return
+		}
+		body = bytes.NewReader(data)
+	}
+
+	unlockRange := func() {}
+	if writer.wrtrAt != nil {
+		// Positional writes do not take the lock of the handle, but overlapping writes are still applied one at a time
+		end := int64(math.MaxInt64)
+		if !openEnded {
+			end = offset + length
+		}
+		writer.lock.lockRange(offset, end)
+		unlockRange = func() {
+			writer.lock.unlockRange(offset, end)
+		}
+	}
+
 	wrtr := writer.newWriteSeeker()
 	fs.logger.Debug("networkfile.FileServer.handleWriteFile: Seeking", "offset", offset)
 	_, err := wrtr.Seek(offset, io.SeekStart)
 	if err != nil {
+		unlockRange()
 		fs.logger.Error("networkfile.FileServer.handleWriteFile: Error seeking", "offset", offset, "error", err)
 		writeErrorToResponseWriter(resp, err)
 		return
 	}
 
-	n, err := io.Copy(wrtr, req.Body)
+	n, err := io.Copy(wrtr, body)
+	unlockRange()
+	// Always report the committed range, so interrupted streams know how much was written
+	resp.Header().Set(HeaderRange, fmt.Sprintf("%d-%d", offset, n))
 	if err != nil {
-		fs.logger.Error("networkfile.FileServer.handleWriteFile: Error writing", "error", err)
+		fs.logger.Error("networkfile.FileServer.handleWriteFile: Error writing", "committed", n, "error", err)
 		writeErrorToResponseWriter(resp, err)
 		return
 	}
 
-	if n != length {
+	if !openEnded && n != length {
 		fs.logger.Debug("networkfile.FileServer.handleWriteFile: Invalid body length", "copied", n, "length", length)
 		resp.WriteHeader(http.StatusBadRequest)
 		_, _ = resp.Write([]byte("invalid body length"))
@@ -410,12 +820,16 @@ func (fs *FileServer) handleWriteFile(resp http.ResponseWriter, req *http.Reques
 
 	fs.logger.Debug("networkfile.FileServer.handleWriteFile: Wrote bytes", "bytes", n, "offset", offset, "fileID", fileID)
 
-	resp.Header().Set(HeaderRange, fmt.Sprintf("%d-%d", offset, n))
+	if fs.allowChecksums && digest != "" {
+		resp.Header().Set(HeaderDigest, digest)
+	}
+	version, _ := fs.fileVersion(fileID)
+	resp.Header().Set(HeaderETag, version)
 	resp.WriteHeader(http.StatusNoContent)
 }
 
 func (fs *FileServer) handleFullWriteFile(resp http.ResponseWriter, req *http.Request, fileID FileID) {
-	if !fs.allowPUT {
+	if !fs.allowed(fileID, OperationWrite, func(p *handlePolicy) *bool { return p.allowPUT }, fs.allowPUT) {
 		resp.WriteHeader(http.StatusForbidden)
 		return
 	}
@@ -429,10 +843,21 @@ func (fs *FileServer) handleFullWriteFile(resp http.ResponseWriter, req *http.Re
 		return
 	}
 
-	writer.mu.Lock()
-	defer writer.mu.Unlock()
+	writer.lock.mu.Lock()
+	defer writer.lock.mu.Unlock()
 
-	n, err := io.Copy(writer.wrtr, req.Body)
+	var dst io.WriteSeeker = writer.wrtr
+	if writer.wrtrAt != nil {
+		// Positional writes do not take the lock of the handle, so the whole file is locked against them
+		writer.lock.lockRange(0, math.MaxInt64)
+		defer writer.lock.unlockRange(0, math.MaxInt64)
+		dst = io.NewOffsetWriter(writer.wrtrAt, 0)
+	}
+	n, err := io.Copy(dst, req.Body)
+	if n > 0 {
+		end, _ := dst.Seek(0, io.SeekCurrent)
+		writer.wrote(end)
+	}
 	if err != nil {
 		fs.logger.Error("networkfile.FileServer.handleFullWriteFile: Error writing to writer", "fileID", fileID, "error", err)
 		writeErrorToResponseWriter(resp, err)
@@ -445,7 +870,7 @@ func (fs *FileServer) handleFullWriteFile(resp http.ResponseWriter, req *http.Re
 
 // handleCloseFile handles http requests to close a reader/writer
 func (fs *FileServer) handleCloseFile(resp http.ResponseWriter, fileID FileID) {
-	if !fs.allowClose {
+	if !fs.allowed(fileID, OperationClose, func(p *handlePolicy) *bool { return p.allowClose }, fs.allowClose) {
 		resp.WriteHeader(http.StatusForbidden)
 		return
 	}
@@ -458,6 +883,9 @@ func (fs *FileServer) handleCloseFile(resp http.ResponseWriter, fileID FileID) {
 	if fs.closeWriter(fileID) {
 		closed++
 	}
+	if fs.closeFSFile(fileID) {
+		closed++
+	}
 	fs.mu.Unlock()
 
 	if closed == 0 {
@@ -467,14 +895,25 @@ func (fs *FileServer) handleCloseFile(resp http.ResponseWriter, fileID FileID) {
 	resp.WriteHeader(http.StatusNoContent)
 }
 
+// closesHandle returns whether removing a reader or writer closes its handle. A handle shared by the reader and
+// writer of ServeFile is closed once the last of them is removed, when either of them is configured to be closed.
+func (fs *FileServer) closesHandle(lock *handleLock, closeConfigured, otherServed bool) bool {
+	if !lock.shared {
+		return closeConfigured
+	}
+	return !otherServed && (fs.closeReaders || fs.closeWriters)
+}
+
 // closeReader closes and removes a reader, assumes a full lock is held
 func (fs *FileServer) closeReader(fileID FileID) bool {
 	if fs.readers[fileID] == nil {
 		return false
 	}
 
-	if fs.closeReaders {
-		closer, ok := fs.readers[fileID].rdr.(io.Closer)
+	lock := fs.readers[fileID].lock
+	writer := fs.writers[fileID]
+	if fs.closesHandle(lock, fs.closeReaders, writer != nil && writer.lock == lock) {
+		closer, ok := fs.readers[fileID].handle().(io.Closer)
 		if ok {
 			fs.logger.Debug("networkfile.FileServer.closeReader: Closer detected, closing", "fileID", fileID)
 			err := closer.Close()
@@ -485,6 +924,7 @@ func (fs *FileServer) closeReader(fileID FileID) bool {
 	}
 
 	delete(fs.readers, fileID)
+	fs.removeServed(fileID)
 	return true
 }
 
@@ -494,8 +934,10 @@ func (fs *FileServer) closeWriter(fileID FileID) bool {
 		return false
 	}
 
-	if fs.closeWriters {
-		closer, ok := fs.writers[fileID].wrtr.(io.Closer)
+	lock := fs.writers[fileID].lock
+	reader := fs.readers[fileID]
+	if fs.closesHandle(lock, fs.closeWriters, reader != nil && reader.lock == lock) {
+		closer, ok := fs.writers[fileID].handle().(io.Closer)
 		if ok {
 			fs.logger.Debug("networkfile.FileServer.closeWriter: Closer detected, closing", "fileID", fileID)
 			err := closer.Close()
@@ -506,5 +948,6 @@ func (fs *FileServer) closeWriter(fileID FileID) bool {
 	}
 
 	delete(fs.writers, fileID)
+	fs.removeServed(fileID)
 	return true
 }
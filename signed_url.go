@@ -0,0 +1,215 @@
+package networkfile
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GETSignedToken is the name of the GET parameter carrying a signed token, which is accepted instead of the shared secret
+const GETSignedToken = "token"
+
+var (
+	ErrForbidden      = errors.New("forbidden: operation not allowed")
+	ErrNoSharedSecret = errors.New("no shared secret to sign with")
+
+	errInvalidToken = errors.New("invalid signed token")
+	errExpiredToken = errors.New("expired signed token")
+)
+
+// signedToken grants access to a single file of the server at a URL prefix with a limited set of methods until it expires
+type signedToken struct {
+	Prefix  string   `json:"p"` // URL prefix of the server, so the token is not accepted by servers at other prefixes
+	FileID  FileID   `json:"f"`
+	Methods []string `json:"m"`
+	Expires int64    `json:"e"`           // Unix time after which the token is no longer valid
+	Offset  int64    `json:"o,omitempty"` // Start of the allowed byte range
+	Length  int64    `json:"l,omitempty"` // Length of the allowed byte range, zero for the whole file
+}
+
+// signToken encodes the token and its signature by the shared secret
+func signToken(sharedSecret string, token signedToken) (string, error) {
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(tokenSignature(sharedSecret, payload)), nil
+}
+
+// tokenSignature returns the HMAC of the token payload, keyed by the shared secret
+func tokenSignature(sharedSecret string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(sharedSecret))
+	// Keep signatures of tokens apart from any other use of the secret
+	_, _ = mac.Write([]byte("networkfile signed token\n"))
+	_, _ = mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// parseToken verifies the signature by any of the shared secrets and the expiry of an encoded token
+func parseToken(sharedSecrets []string, value string, now time.Time) (signedToken, error) {
+	var token signedToken
+	encodedPayload, encodedSignature, ok := strings.Cut(value, ".")
+	if !ok {
+		return token, errInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return token, errInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return token, errInvalidToken
+	}
+	valid := false
+	for _, secret := range sharedSecrets {
+		// Anyone can sign with an empty secret, so it never verifies a token
+		if secret == "" {
+			continue
+		}
+		if hmac.Equal(signature, tokenSignature(secret, payload)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return token, errInvalidToken
+	}
+	err = json.Unmarshal(payload, &token)
+	if err != nil {
+		return token, errInvalidToken
+	}
+	if now.Unix() >= token.Expires {
+		return token, errExpiredToken
+	}
+	return token, nil
+}
+
+// allows returns whether the token permits the request. Normal GET requests of a token limited
+// to a byte range are turned into a read of that range.
+func (t *signedToken) allows(req *http.Request, urlPrefix string, fileID FileID) bool {
+	if t.Prefix != urlPrefix || t.FileID != fileID || !slices.Contains(t.Methods, req.Method) {
+		return false
+	}
+	if t.Length == 0 {
+		return true
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		if req.Header.Get(HeaderRange) == "" {
+			req.Header.Set(HeaderRange, fmt.Sprintf("%d-%d", t.Offset, t.Length))
+			return true
+		}
+	case http.MethodPatch:
+	case http.MethodPut:
+		return t.Offset == 0 && req.ContentLength >= 0 && req.ContentLength <= t.Length
+	default:
+		return true
+	}
+
+	var offset, length int64
+	matches, err := fmt.Sscanf(req.Header.Get(HeaderRange), "%d-%d", &offset, &length)
+	if err != nil || matches != 2 {
+		return false
+	}
+	return offset >= t.Offset && length >= 0 && length <= t.Offset+t.Length-offset
+}
+
+// checkSignedToken verifies the signed token of the request, writing an error response when it is not allowed
+func (fs *FileServer) checkSignedToken(resp http.ResponseWriter, req *http.Request, value string) bool {
+	token, err := parseToken(fs.secrets.Secrets(), value, time.Now())
+	if err != nil {
+		fs.logger.Debug("networkfile.FileServer.checkSignedToken: Invalid token", "error", err)
+		resp.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+
+	fileID := FileID(strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, fs.urlPrefix), "/"))
+	if !token.allows(req, strings.TrimSuffix(fs.urlPrefix, "/"), fileID) {
+		fs.logger.Debug("networkfile.FileServer.checkSignedToken: Request not allowed by token",
+			"prefix", token.Prefix, "fileID", fileID, "method", req.Method, "range", req.Header.Get(HeaderRange))
+		writeErrorToResponseWriter(resp, ErrForbidden)
+		return false
+	}
+	return true
+}
+
+// SignURL returns a URL at which the file can be accessed with the given methods until the TTL expires, signed by
+// the first shared secret of the server. The base URL is the scheme and host at which clients reach the server.
+func (fs *FileServer) SignURL(baseURL string, fileID FileID, ttl time.Duration, methods ...string) (string, error) {
+	secrets := fs.secrets.Secrets()
+	if len(secrets) == 0 || secrets[0] == "" {
+		return "", ErrNoSharedSecret
+	}
+	urlPrefix := strings.TrimSuffix(fs.urlPrefix, "/")
+	return signURL(secrets[0], strings.TrimSuffix(baseURL, "/")+urlPrefix, urlPrefix, signedToken{
+		FileID:  fileID,
+		Methods: methods,
+		Expires: time.Now().Add(ttl).Unix(),
+	})
+}
+
+// SignedURL returns a URL at which the file can be accessed with the given methods until the TTL expires.
+// Unlike the URLs containing the shared secret, it only grants access to this file.
+func (f *file) SignedURL(ttl time.Duration, methods ...string) (string, error) {
+	return f.signedURL(ttl, 0, 0, methods...)
+}
+
+// SignedReadURL returns a URL at which the file can be downloaded via a normal GET request until the TTL expires.
+// Unlike FullReadURL, it does not contain the shared secret and only grants access to this file.
+func (r *Reader) SignedReadURL(ttl time.Duration) (string, error) {
+	return r.signedURL(ttl, 0, 0, http.MethodGet, http.MethodOptions)
+}
+
+// SignedRangeURL returns a URL at which the given byte range of the file can be downloaded until the TTL expires
+func (r *Reader) SignedRangeURL(ttl time.Duration, offset, length int64) (string, error) {
+	if offset < 0 || length < MinumumBufferSize {
+		return "", ErrUnsupportedOperation
+	}
+	return r.signedURL(ttl, offset, length, http.MethodGet, http.MethodOptions)
+}
+
+// SignedPutURL returns a URL at which the file can be PUT in a single request until the TTL expires.
+// Unlike PutURL, it does not contain the shared secret and only grants access to this file.
+func (w *Writer) SignedPutURL(ttl time.Duration) (string, error) {
+	return w.signedURL(ttl, 0, 0, http.MethodPut)
+}
+
+// signedURL returns the URL of the file with a token signed by the shared secret
+func (f *file) signedURL(ttl time.Duration, offset, length int64, methods ...string) (string, error) {
+	if f.sharedSecret == "" {
+		return "", ErrNoSharedSecret
+	}
+	base, err := url.Parse(f.baseURL)
+	if err != nil {
+		return "", err
+	}
+	return signURL(f.sharedSecret, f.baseURL, strings.TrimSuffix(base.Path, "/"), signedToken{
+		FileID:  f.fileID,
+		Methods: methods,
+		Expires: time.Now().Add(ttl).Unix(),
+		Offset:  offset,
+		Length:  length,
+	})
+}
+
+// signURL binds the token to the URL prefix and returns the URL of its file with the token signed by the shared secret
+func signURL(sharedSecret, baseURL, urlPrefix string, token signedToken) (string, error) {
+	if len(token.Methods) == 0 {
+		return "", ErrUnsupportedOperation
+	}
+	token.Prefix = urlPrefix
+	value, err := signToken(sharedSecret, token)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s?%s=%s", strings.TrimSuffix(baseURL, "/"), token.FileID, GETSignedToken, value), nil
+}
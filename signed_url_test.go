@@ -0,0 +1,235 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedReadURL(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	otherID, err := RandomFileID()
+	assert.NoError(t, err)
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	err = srv.ServeFileReader(context.Background(), fileID, bytes.NewReader(data))
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), otherID, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	request := func(method, url string, headers map[string]string) (*http.Response, []byte) {
+		req, err := http.NewRequest(method, url, nil)
+		assert.NoError(t, err)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp, body
+	}
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	url, err := rdr.SignedReadURL(time.Minute)
+	assert.NoError(t, err)
+	assert.NotContains(t, url, secret)
+
+	resp, body := request(http.MethodGet, url, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, data, body)
+	resp, _ = request(http.MethodOptions, url, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = request(http.MethodDelete, url, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = request(http.MethodGet, strings.Replace(url, string(fileID), string(otherID), 1), nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = request(http.MethodGet, url[:len(url)-2], nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	expired, err := rdr.SignedReadURL(-time.Second)
+	assert.NoError(t, err)
+	resp, _ = request(http.MethodGet, expired, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	url, err = rdr.SignedRangeURL(time.Minute, 10, 20)
+	assert.NoError(t, err)
+	resp, body = request(http.MethodGet, url, nil)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, data[10:30], body)
+	resp, body = request(http.MethodGet, url, map[string]string{HeaderRange: "15-5"})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, data[15:20], body)
+	resp, _ = request(http.MethodGet, url, map[string]string{HeaderRange: "25-10"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Without the shared secret as GET parameter, only signed URLs work in a browser
+	srv.AllowSecretInURL(false)
+	resp, _ = request(http.MethodGet, rdr.FullReadURL(), nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, _ = request(http.MethodGet, url, nil)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+
+	_, err = NewClient(testServer.URL+prefix).OpenReader(context.Background(), fileID).SignedReadURL(time.Minute)
+	assert.ErrorIs(t, err, ErrNoSharedSecret)
+}
+
+func TestSignedPutURL(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "signed-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = os.Remove(dst.Name())
+	}()
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	url, err := wrtr.SignedPutURL(time.Minute)
+	assert.NoError(t, err)
+	assert.NotContains(t, url, secret)
+
+	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader("hello world"))
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Less(t, resp.StatusCode, 300)
+
+	data, err := os.ReadFile(dst.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	req, err = http.NewRequest(http.MethodPatch, url, strings.NewReader("x"))
+	assert.NoError(t, err)
+	req.Header.Set(HeaderRange, "0-1")
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestSignedURL(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "signed-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	request := func(method, url string, body string, headers map[string]string) int {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		assert.NoError(t, err)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	_, err = wrtr.SignedURL(time.Minute)
+	assert.ErrorIs(t, err, ErrUnsupportedOperation)
+	url, err := wrtr.SignedURL(time.Minute, http.MethodPatch)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, request(http.MethodPatch, url, "hello", map[string]string{HeaderRange: "0-5"}))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodDelete, url, "", nil))
+
+	// URLs can also be minted by the server, without a client
+	url, err = srv.SignURL(testServer.URL, fileID, time.Minute, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPatch, url, "x", map[string]string{HeaderRange: "0-1"}))
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, url, "", nil))
+
+	data, err := os.ReadFile(dst.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	_, err = NewFileServer(prefix, "").SignURL(testServer.URL, fileID, time.Minute, http.MethodGet)
+	assert.ErrorIs(t, err, ErrNoSharedSecret)
+}
+
+func TestSignedURLPrefix(t *testing.T) {
+	mux := http.NewServeMux()
+	srvA := NewFileServer("/a", secret)
+	srvB := NewFileServer("/b", secret)
+	mux.Handle("/a/", srvA)
+	mux.Handle("/b/", srvB)
+	testServer := httptest.NewServer(mux)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	data := []byte("hello world")
+	assert.NoError(t, srvA.ServeFileReader(context.Background(), fileID, bytes.NewReader(data)))
+	assert.NoError(t, srvB.ServeFileReader(context.Background(), fileID, bytes.NewReader(data)))
+
+	get := func(url string) int {
+		resp, err := http.Get(url)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// A token is only accepted by the server at the prefix it was signed for, even when both share a secret
+	url, err := NewReader(context.Background(), testServer.URL+"/a/", secret, fileID).SignedReadURL(time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get(url))
+	assert.Equal(t, http.StatusForbidden, get(strings.Replace(url, "/a/", "/b/", 1)))
+
+	url, err = srvB.SignURL(testServer.URL, fileID, time.Minute, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get(url))
+	assert.Equal(t, http.StatusForbidden, get(strings.Replace(url, "/b/", "/a/", 1)))
+}
+
+func TestSignedURLEmptySecret(t *testing.T) {
+	srv := NewFileServer(prefix, "")
+	srv.SetAuthenticator(NewBearerTokenAuthenticator(map[string]Identity{"token-1": "service-1"}))
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), fileID, bytes.NewReader(make([]byte, 100)))
+	assert.NoError(t, err)
+
+	// A token signed with the empty secret is never accepted
+	url, err := signURL("", testServer.URL+prefix, prefix, signedToken{
+		FileID:  fileID,
+		Methods: []string{http.MethodGet},
+		Expires: time.Now().Add(time.Minute).Unix(),
+	})
+	assert.NoError(t, err)
+	resp, err := http.Get(url)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, value, _ := strings.Cut(url, GETSignedToken+"=")
+	_, err = parseToken([]string{""}, value, time.Now())
+	assert.ErrorIs(t, err, errInvalidToken)
+}
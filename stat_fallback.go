@@ -0,0 +1,71 @@
+package networkfile
+
+import (
+	"io"
+	"os"
+)
+
+// sizer is implemented by handles that know their size, such as bytes.Reader and io.SectionReader
+type sizer interface {
+	Size() int64
+}
+
+// synthesizeStat returns file information for served handles that do not implement Statter.
+// The size is taken from the handle when it can tell, and from the bytes written through the server otherwise.
+func synthesizeStat(fileID FileID, reader *concurrentReadSeeker, writer *concurrentWriteSeeker) (os.FileInfo, error) {
+	info := &FileInfo{
+		FileName: string(fileID),
+		FileSize: -1,
+		FileMode: 0o444,
+	}
+	if reader != nil {
+		info.FileSize = handleSize(reader.handle(), reader.lock)
+		info.FileModTime = reader.registered.UnixNano()
+	}
+	if writer != nil {
+		size := handleSize(writer.handle(), writer.lock)
+		if highWater := writer.highWater.Load(); highWater > size {
+			size = highWater
+		}
+		if size > info.FileSize {
+			info.FileSize = size
+		}
+		info.FileModTime = writer.registered.UnixNano()
+		info.FileMode = 0o644
+	}
+	if info.FileSize < 0 {
+		return nil, ErrUnsupportedOperation
+	}
+	return info, nil
+}
+
+// handleSize returns the size of a handle, or -1 when it is unknown.
+// Handles without a Size method are sought to the end and back while holding the lock of the handle.
+func handleSize(handle interface{}, lock *handleLock) int64 {
+	if file, ok := handle.(sizer); ok {
+		return file.Size()
+	}
+	seeker, ok := handle.(io.Seeker)
+	if !ok {
+		return -1
+	}
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	// Make the next read or write seek to its own offset again
+	lock.lastChange = nil
+
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	size, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	_, err = seeker.Seek(current, io.SeekStart)
+	if err != nil {
+		return -1
+	}
+	return size
+}
@@ -0,0 +1,82 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// plainReadSeeker hides every method of the reader except Read and Seek
+type plainReadSeeker struct {
+	io.ReadSeeker
+}
+
+func TestStatFallbackReader(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	sizedID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), sizedID, bytes.NewReader(data))
+	assert.NoError(t, err)
+	seekerID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReader(context.Background(), seekerID, plainReadSeeker{bytes.NewReader(data)})
+	assert.NoError(t, err)
+
+	for _, fileID := range []FileID{sizedID, seekerID} {
+		rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+		buf := make([]byte, 10)
+		_, err = io.ReadFull(rdr, buf)
+		assert.NoError(t, err)
+
+		fi, err := rdr.Stat()
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1000, fi.Size())
+		assert.Equal(t, string(fileID), fi.Name())
+		assert.WithinDuration(t, time.Now(), fi.ModTime(), time.Minute)
+
+		// Statting does not move the handle
+		_, err = io.ReadFull(rdr, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, data[10:20], buf)
+	}
+
+	// A handle without any way of telling its size cannot be statted
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileReaderAt(context.Background(), fileID, &trackingBuffer{data: data})
+	assert.NoError(t, err)
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	_, err = rdr.Stat()
+	assert.ErrorIs(t, err, ErrUnsupportedOperation)
+}
+
+func TestStatFallbackWriterHighWater(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	err = srv.ServeFileWriterAt(context.Background(), fileID, &trackingBuffer{})
+	assert.NoError(t, err)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	fi, err := wrtr.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, fi.Size())
+
+	_, err = wrtr.WriteAt(make([]byte, 100), 500)
+	assert.NoError(t, err)
+	_, err = wrtr.WriteAt(make([]byte, 100), 0)
+	assert.NoError(t, err)
+	fi, err = wrtr.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 600, fi.Size())
+}
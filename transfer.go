@@ -0,0 +1,143 @@
+package networkfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// DefaultTransferChunkSize is the chunk size of resumable transfers when none is configured
+	DefaultTransferChunkSize = 4 * 1024 * 1024
+
+	// DefaultTransferParallelism is the amount of concurrent requests of resumable transfers when none is configured
+	DefaultTransferParallelism = 4
+)
+
+// transferJournal is the on-disk checkpoint of a resumable transfer
+type transferJournal struct {
+	FileID    FileID     `json:"fileid"`             // Remote file of the transfer
+	Version   string     `json:"version"`            // Version of the remote file a download was started from
+	Size      int64      `json:"size"`               // Size of the transferred file
+	ModTime   int64      `json:"modtime"`            // Modification time of the source file in nanoseconds
+	ChunkSize int        `json:"chunksize"`          // Size of the chunks the transfer was split into
+	Done      byteRanges `json:"done"`               // Ranges that were completely transferred
+	Pending   byteRanges `json:"pending,omitempty"`  // Ranges of uploads that were started, but not confirmed
+	Versions  []string   `json:"versions,omitempty"` // Versions of the remote file reported by the last confirmed uploads
+}
+
+// loadJournal reads the journal at the given path, returning nil if it does not exist
+func loadJournal(path string) (*transferJournal, error) {
+	data, err := os.ReadFile(path) // nolint:gosec
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &transferJournal{}
+	err = json.Unmarshal(data, journal)
+	if err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+// save atomically writes the journal to the given path
+func (j *transferJournal) save(path string) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// matches returns whether the journal was written for the remote file and a file with the given size,
+// modification time and chunk size
+func (j *transferJournal) matches(fileID FileID, size, modTime int64, chunkSize int) bool {
+	return j.FileID == fileID && j.Size == size && j.ModTime == modTime && j.ChunkSize == chunkSize
+}
+
+// transferChunks calls transfer for every chunk with at most parallelism concurrent calls,
+// and calls done, if not nil, for every successfully transferred chunk. It stops at the first error, after which
+// the context passed to transfer is cancelled.
+func transferChunks(ctx context.Context, chunks byteRanges, parallelism int,
+	transfer func(ctx context.Context, chunk byteRange) error, done func(chunk byteRange) error,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var firstErr error
+	var mu sync.Mutex
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	queue := make(chan byteRange)
+	wg := sync.WaitGroup{}
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range queue {
+				err := transfer(ctx, chunk)
+				if err == nil && done != nil {
+					mu.Lock()
+					err = done(chunk)
+					mu.Unlock()
+				}
+				if err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	stopped := false
+	for _, chunk := range chunks {
+		select {
+		case queue <- chunk:
+		case <-ctx.Done():
+			stopped = true
+		}
+		if stopped {
+			break
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if stopped {
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package networkfile
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+)
+
+// UploadOptions configures a resumable upload
+type UploadOptions struct {
+	ChunkSize   int    // Size of the individual write requests, defaults to DefaultTransferChunkSize
+	Parallelism int    // Amount of concurrent write requests, defaults to DefaultTransferParallelism
+	JournalPath string // Location of the checkpoint journal, defaults to the file path with an .upload-journal suffix
+}
+
+// Upload uploads the local file at the given path to the remote file of the writer, writing chunks in parallel.
+// Acknowledged ranges are recorded in a checkpoint journal on local disk, so an interrupted upload
+// resumes with only the missing ranges when it is called again. Ranges that were being written when the upload
+// was interrupted are written again. The journal is reconciled with the size the server reports, and removed
+// once the upload completes. The upload starts over when the journal was written for another FileID, or when
+// the remote file was changed by someone else. Such changes can only be detected when no writes were
+// unconfirmed when the upload was interrupted.
+// Buffering and pipelining of the writer are bypassed, as every chunk must be acknowledged before it is recorded.
+// The context also cancels the write requests in flight.
+func Upload(ctx context.Context, wrtr *Writer, path string, opts UploadOptions) error {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultTransferChunkSize
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = DefaultTransferParallelism
+	}
+	if opts.JournalPath == "" {
+		opts.JournalPath = path + ".upload-journal"
+	}
+
+	src, err := os.Open(path) // nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	journal, err := loadJournal(opts.JournalPath)
+	if err != nil {
+		wrtr.logger.Info("networkfile.Upload: Ignoring unreadable journal", "path", opts.JournalPath, "error", err)
+	}
+	if journal == nil || !journal.matches(wrtr.fileID, fi.Size(), fi.ModTime().UnixNano(), opts.ChunkSize) {
+		journal = &transferJournal{
+			FileID:    wrtr.fileID,
+			Size:      fi.Size(),
+			ModTime:   fi.ModTime().UnixNano(),
+			ChunkSize: opts.ChunkSize,
+		}
+	}
+
+	err = reconcileUpload(wrtr, journal)
+	if err != nil {
+		return err
+	}
+
+	if wrtr.ctx != nil {
+		// Write requests end with either the context of the upload or that of the writer
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		defer context.AfterFunc(wrtr.ctx, cancel)()
+	}
+
+	chunks := journal.Done.missing(0, journal.Size).split(int64(opts.ChunkSize))
+	wrtr.logger.Debug("networkfile.Upload: Uploading chunks", "fileID", wrtr.fileID, "path", path, "chunks", len(chunks))
+
+	var journalMu sync.Mutex
+	record := func(update func()) error {
+		journalMu.Lock()
+		defer journalMu.Unlock()
+		update()
+		return journal.save(opts.JournalPath)
+	}
+	err = transferChunks(ctx, chunks, opts.Parallelism, func(ctx context.Context, chunk byteRange) error {
+		buf := make([]byte, chunk.End-chunk.Start)
+		_, err := src.ReadAt(buf, chunk.Start)
+		if err != nil {
+			return err
+		}
+		// Record the write before sending it, so a resumed upload knows it may have changed the remote file
+		err = record(func() {
+			journal.Pending.add(chunk.Start, chunk.End)
+		})
+		if err != nil {
+			return err
+		}
+
+		_, version, err := wrtr.sendContext(ctx, buf, chunk.Start)
+		if err != nil {
+			var urlErr *url.Error
+			if !errors.As(err, &urlErr) {
+				// The server responded, so the write is no longer in flight. Should it have changed the remote
+				// file anyway, the upload starts over instead of resuming.
+				_ = record(func() {
+					journal.Pending.remove(chunk.Start, chunk.End)
+				})
+			}
+			return err
+		}
+		return record(func() {
+			journal.Pending.remove(chunk.Start, chunk.End)
+			journal.Done.add(chunk.Start, chunk.End)
+			journal.recordVersion(version, opts.Parallelism)
+		})
+	}, nil)
+	if err != nil {
+		wrtr.logger.Info("networkfile.Upload: Upload interrupted", "fileID", wrtr.fileID, "path", path, "error", err)
+		return err
+	}
+
+	err = os.Remove(opts.JournalPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// reconcileUpload drops the ranges from the journal that the server does not have. Ranges that were pending
+// are not in the journal, so they are written again.
+func reconcileUpload(wrtr *Writer, journal *transferJournal) error {
+	pending := journal.Pending
+	journal.Pending = nil
+	if len(journal.Done) == 0 {
+		return nil
+	}
+
+	remote, err := wrtr.file.stat()
+	if errors.Is(err, ErrUnsupportedOperation) {
+		wrtr.logger.Debug("networkfile.Upload: Server does not support stat, trusting journal", "fileID", wrtr.fileID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Pending writes change the version without it being recorded, so changes by someone else can only be told
+	// apart from them when nothing was pending
+	version := wrtr.statETag()
+	if version != "" && len(pending) == 0 && !slices.Contains(journal.Versions, version) {
+		wrtr.logger.Info("networkfile.Upload: Remote file changed, starting over",
+			"fileID", wrtr.fileID, "version", version, "journalVersions", journal.Versions)
+		journal.Done = nil
+		journal.Versions = nil
+		return nil
+	}
+	journal.Done = journal.Done.clip(remote.FileSize)
+	return nil
+}
+
+// recordVersion records the version reported by a confirmed write. Up to parallelism writes are in flight
+// at the same time, so their responses can arrive in another order than the server processed them. The
+// version of the write the server processed last is always among the last parallelism confirmed writes.
+func (j *transferJournal) recordVersion(version string, parallelism int) {
+	if version == "" {
+		return
+	}
+	j.Versions = append(j.Versions, version)
+	if len(j.Versions) > parallelism {
+		j.Versions = j.Versions[len(j.Versions)-parallelism:]
+	}
+}
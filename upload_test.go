@@ -0,0 +1,275 @@
+package networkfile
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadResume(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var patches int64
+	var failAfter int64 = 3
+	testServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPatch && atomic.AddInt64(&patches, 1) > atomic.LoadInt64(&failAfter) {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "upload-dst-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	src, err := randomFile(10_500)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	opts := UploadOptions{
+		ChunkSize:   1000,
+		Parallelism: 1,
+	}
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+
+	err = Upload(context.Background(), wrtr, src.Name(), opts)
+	assert.Error(t, err)
+	assert.FileExists(t, src.Name()+".upload-journal")
+
+	atomic.StoreInt64(&patches, 0)
+	atomic.StoreInt64(&failAfter, 100)
+
+	err = Upload(context.Background(), wrtr, src.Name(), opts)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, src.Name()+".upload-journal")
+	assert.EqualValues(t, 8, atomic.LoadInt64(&patches))
+
+	_, err = dst.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	dstBuf, err := io.ReadAll(dst)
+	assert.NoError(t, err)
+
+	_, err = src.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, srcBuf, dstBuf)
+}
+
+func TestUploadResumeParallel(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var patches int64
+	var loseAfter int64 = 5
+	testServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPatch && atomic.AddInt64(&patches, 1) > atomic.LoadInt64(&loseAfter) {
+			// The server writes the chunk, but the connection breaks before the response arrives
+			srv.ServeHTTP(httptest.NewRecorder(), req)
+			conn, _, err := resp.(http.Hijacker).Hijack()
+			assert.NoError(t, err)
+			_ = conn.Close()
+			return
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "upload-dst-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	src, err := randomFile(10_500)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	opts := UploadOptions{
+		ChunkSize:   1000,
+		Parallelism: 4,
+	}
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+
+	err = Upload(context.Background(), wrtr, src.Name(), opts)
+	assert.Error(t, err)
+	journal, err := loadJournal(src.Name() + ".upload-journal")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, journal.Done)
+	assert.NotEmpty(t, journal.Pending)
+	missing := journal.Done.missing(0, journal.Size).split(int64(opts.ChunkSize))
+	assert.Less(t, len(missing), 11)
+
+	// Unconfirmed writes changed the remote version, but only they and the missing chunks are sent again.
+	// Writes are counted by the client, as cancelled writes of the interrupted upload may still reach the server.
+	atomic.StoreInt64(&loseAfter, 100)
+	metrics := NewMetricsObserver()
+	wrtr = NewClient(testServer.URL+prefix, WithSharedSecret(secret), WithObserver(metrics)).OpenWriter(context.Background(), fileID)
+	err = Upload(context.Background(), wrtr, src.Name(), opts)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, src.Name()+".upload-journal")
+	assert.EqualValues(t, len(missing), metrics.Metrics()[OperationWrite].Requests)
+
+	_, err = dst.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	dstBuf, err := io.ReadAll(dst)
+	assert.NoError(t, err)
+
+	_, err = src.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, srcBuf, dstBuf)
+}
+
+func TestUploadReconcilesJournal(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "upload-dst-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	src, err := randomFile(5000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	fi, err := src.Stat()
+	assert.NoError(t, err)
+
+	// A journal claiming everything was uploaded, while the server has nothing
+	journalPath := src.Name() + ".upload-journal"
+	journal := &transferJournal{
+		FileID:    fileID,
+		Size:      fi.Size(),
+		ModTime:   fi.ModTime().UnixNano(),
+		ChunkSize: 1000,
+	}
+	journal.Done.add(0, fi.Size())
+	assert.NoError(t, journal.save(journalPath))
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	err = Upload(context.Background(), wrtr, src.Name(), UploadOptions{ChunkSize: 1000})
+	assert.NoError(t, err)
+
+	_, err = dst.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	dstBuf, err := io.ReadAll(dst)
+	assert.NoError(t, err)
+
+	_, err = src.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, srcBuf, dstBuf)
+}
+
+func TestUploadStartsOverForChangedRemote(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var patches int64
+	var failAfter int64 = 3
+	testServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPatch && atomic.AddInt64(&patches, 1) > atomic.LoadInt64(&failAfter) {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+
+	serve := func() (FileID, *os.File) {
+		fileID, err := RandomFileID()
+		assert.NoError(t, err)
+		dst, err := os.CreateTemp(os.TempDir(), "upload-dst-")
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			_ = dst.Close()
+			_ = os.Remove(dst.Name())
+		})
+		err = srv.ServeFileWriter(context.Background(), fileID, dst)
+		assert.NoError(t, err)
+		return fileID, dst
+	}
+
+	src, err := randomFile(5000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	opts := UploadOptions{
+		ChunkSize:   1000,
+		Parallelism: 1,
+	}
+	fileID, dst := serve()
+	err = Upload(context.Background(), NewWriter(context.Background(), testServer.URL+prefix, secret, fileID), src.Name(), opts)
+	assert.Error(t, err)
+	assert.FileExists(t, src.Name()+".upload-journal")
+
+	// Someone else overwrites a range the journal recorded as uploaded
+	atomic.StoreInt64(&failAfter, 100)
+	_, err = NewWriter(context.Background(), testServer.URL+prefix, secret, fileID).WriteAt(make([]byte, 1000), 0)
+	assert.NoError(t, err)
+
+	atomic.StoreInt64(&patches, 0)
+	err = Upload(context.Background(), NewWriter(context.Background(), testServer.URL+prefix, secret, fileID), src.Name(), opts)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, atomic.LoadInt64(&patches))
+	dstBuf, err := os.ReadFile(dst.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, srcBuf, dstBuf)
+
+	// A journal of another remote file is not resumed either
+	atomic.StoreInt64(&failAfter, 3)
+	atomic.StoreInt64(&patches, 0)
+	err = Upload(context.Background(), NewWriter(context.Background(), testServer.URL+prefix, secret, fileID), src.Name(), opts)
+	assert.Error(t, err)
+
+	otherID, other := serve()
+	atomic.StoreInt64(&failAfter, 100)
+	atomic.StoreInt64(&patches, 0)
+	err = Upload(context.Background(), NewWriter(context.Background(), testServer.URL+prefix, secret, otherID), src.Name(), opts)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, atomic.LoadInt64(&patches))
+	dstBuf, err = os.ReadFile(other.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, srcBuf, dstBuf)
+}
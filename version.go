@@ -0,0 +1,187 @@
+package networkfile
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// HeaderETag is the header used to send the version of a file
+	HeaderETag = "ETag"
+
+	// HeaderIfMatch is the header used to only perform a request when the file has one of the given versions
+	HeaderIfMatch = "If-Match"
+
+	// HeaderIfNoneMatch is the header used to only perform a request when the file has none of the given versions
+	HeaderIfNoneMatch = "If-None-Match"
+)
+
+// ErrFileChanged is returned when the remote file no longer has the expected version
+var ErrFileChanged = errors.New("precondition failed: file changed")
+
+// handleGenerations hands out the initial generation of served handles, so re-serving
+// a FileID with another handle changes its version
+var handleGenerations atomic.Uint64
+
+// Version returns the version of the remote file the reader is pinned to, or an empty
+// string if the reader did not read yet or the server does not send versions
+func (r *Reader) Version() string {
+	r.versionMu.Lock()
+	defer r.versionMu.Unlock()
+	return r.version
+}
+
+// ResetVersion unpins the version of the remote file, so the reader accepts a changed file
+// after ErrFileChanged. The next read pins the new version and drops cached blocks.
+func (r *Reader) ResetVersion() {
+	r.unpinVersion()
+	r.closeStream()
+	if r.cache != nil {
+		r.cache.mu.Lock()
+		r.cache.purge()
+		r.cache.mu.Unlock()
+	}
+}
+
+// unpinVersion unpins the version of the remote file
+func (r *Reader) unpinVersion() {
+	r.versionMu.Lock()
+	defer r.versionMu.Unlock()
+	r.version = ""
+}
+
+// pinVersion pins the reader to the given version on the first read, and fails if a later read returns another version
+func (r *Reader) pinVersion(version string) error {
+	if version == "" || r.noPinning {
+		return nil
+	}
+
+	r.versionMu.Lock()
+	defer r.versionMu.Unlock()
+	if r.version == "" {
+		r.version = version
+		return nil
+	}
+	if r.version != version {
+		return ErrFileChanged
+	}
+	return nil
+}
+
+// cachedVersion is the version of a served file, along with the generations and changes of its handles it was derived from
+type cachedVersion struct {
+	handles string
+	version string
+}
+
+// fileVersion returns the version of a served file, derived from its modification time, size and the
+// generations of its handles. It returns false if the file is not served. Handles that can be statted are
+// statted every time, so changes made outside of the server are noticed. The versions of other handles, whose
+// information is synthesized by seeking, are cached until they are written, truncated or allocated.
+func (fs *FileServer) fileVersion(fileID FileID) (string, bool) {
+	fs.mu.RLock()
+	reader := fs.readers[fileID]
+	writer := fs.writers[fileID]
+	fsFile := fs.fsFiles[fileID]
+	fs.mu.RUnlock()
+
+	if reader == nil && writer == nil && fsFile == nil {
+		return "", false
+	}
+
+	var handles strings.Builder
+	if reader != nil {
+		_, _ = fmt.Fprintf(&handles, "r%d-", reader.generation)
+	}
+	if writer != nil {
+		_, _ = fmt.Fprintf(&handles, "w%d.%d-", writer.generation, writer.changes.Load())
+	}
+	if fsFile != nil {
+		_, _ = fmt.Fprintf(&handles, "f%d-", fsFile.generation)
+	}
+
+	cacheable := fsFile == nil && !statsHandle(reader, writer)
+	if cacheable {
+		fs.versionsMu.Lock()
+		cached, ok := fs.versions[fileID]
+		fs.versionsMu.Unlock()
+		if ok && cached.handles == handles.String() {
+			return cached.version, true
+		}
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(handles.String()))
+	fi, err := fs.statHandle(fileID)
+	if err == nil {
+		_, _ = fmt.Fprintf(h, "%d-%d", fi.ModTime().UnixNano(), fi.Size())
+	}
+	version := fmt.Sprintf(`"%016x"`, h.Sum64())
+
+	if cacheable {
+		fs.versionsMu.Lock()
+		fs.versions[fileID] = cachedVersion{
+			handles: handles.String(),
+			version: version,
+		}
+		fs.versionsMu.Unlock()
+	}
+	return version, true
+}
+
+// statsHandle returns whether the information of a served reader or writer is retrieved with its Stat method
+func statsHandle(reader *concurrentReadSeeker, writer *concurrentWriteSeeker) bool {
+	var handle interface{}
+	if reader != nil {
+		handle = reader.handle()
+	} else {
+		handle = writer.handle()
+	}
+	_, ok := handle.(Statter)
+	return ok
+}
+
+// forgetVersion removes the cached version of a file that is no longer served
+func (fs *FileServer) forgetVersion(fileID FileID) {
+	fs.versionsMu.Lock()
+	defer fs.versionsMu.Unlock()
+	delete(fs.versions, fileID)
+}
+
+// checkPreconditions checks the If-Match and If-None-Match headers of the request against the version
+// of the file, and writes the response if the request should not be performed
+func (fs *FileServer) checkPreconditions(resp http.ResponseWriter, req *http.Request, version string) bool {
+	ifMatch := req.Header.Get(HeaderIfMatch)
+	if ifMatch != "" && !versionMatches(ifMatch, version) {
+		fs.logger.Debug("networkfile.FileServer.checkPreconditions: Version does not match",
+			"ifMatch", ifMatch, "version", version)
+		writeErrorToResponseWriter(resp, ErrFileChanged)
+		return false
+	}
+
+	ifNoneMatch := req.Header.Get(HeaderIfNoneMatch)
+	if ifNoneMatch != "" && versionMatches(ifNoneMatch, version) {
+		if req.Method == http.MethodGet || req.Method == http.MethodOptions {
+			resp.WriteHeader(http.StatusNotModified)
+		} else {
+			writeErrorToResponseWriter(resp, ErrFileChanged)
+		}
+		return false
+	}
+	return true
+}
+
+// versionMatches returns whether the version is in the comma separated list of versions
+func versionMatches(list, version string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package networkfile
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderVersionPinning(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(1000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+	err = srv.ServeFileWriter(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	assert.Empty(t, rdr.Version())
+	buf := make([]byte, 100)
+	_, err = rdr.ReadAt(buf, 0)
+	assert.NoError(t, err)
+	version := rdr.Version()
+	assert.NotEmpty(t, version)
+
+	_, err = rdr.ReadAt(buf, 500)
+	assert.NoError(t, err)
+	assert.Equal(t, version, rdr.Version())
+
+	// Writing through the server changes the version, even when size and modification time do not change
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	_, err = wrtr.WriteAt([]byte("changed"), 0)
+	assert.NoError(t, err)
+
+	_, err = rdr.ReadAt(buf, 0)
+	assert.ErrorIs(t, err, ErrFileChanged)
+
+	rdr.ResetVersion()
+	_, err = rdr.ReadAt(buf, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "changed", string(buf[:7]))
+	assert.NotEqual(t, version, rdr.Version())
+}
+
+func TestStatRevalidation(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var notModified int64
+	testServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		rec := &statusRecorder{ResponseWriter: resp}
+		srv.ServeHTTP(rec, req)
+		if rec.status == http.StatusNotModified {
+			atomic.AddInt64(&notModified, 1)
+		}
+	}))
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(1000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+	fi, err := rdr.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1000, fi.Size())
+
+	fi, err = rdr.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1000, fi.Size())
+	assert.EqualValues(t, 1, atomic.LoadInt64(&notModified))
+
+	_, err = src.WriteAt(make([]byte, 10), 1000)
+	assert.NoError(t, err)
+	fi, err = rdr.Stat()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1010, fi.Size())
+	assert.EqualValues(t, 1, atomic.LoadInt64(&notModified))
+}
+
+func TestServerPreconditions(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	src, err := randomFile(100)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	err = srv.ServeFileReader(context.Background(), fileID, src)
+	assert.NoError(t, err)
+	err = srv.ServeFileWriter(context.Background(), fileID, src)
+	assert.NoError(t, err)
+
+	request := func(method string, headers map[string]string) *http.Response {
+		req, err := http.NewRequest(method, testServer.URL+prefix+"/"+string(fileID), nil)
+		assert.NoError(t, err)
+		req.Header.Set(HeaderSharedSecret, secret)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	resp := request(http.MethodOptions, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	version := resp.Header.Get(HeaderETag)
+	assert.NotEmpty(t, version)
+
+	resp = request(http.MethodGet, map[string]string{HeaderIfNoneMatch: version})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	resp = request(http.MethodGet, map[string]string{HeaderRange: "0-10", HeaderIfNoneMatch: version})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	resp = request(http.MethodGet, map[string]string{HeaderRange: "0-10", HeaderIfMatch: `"other", ` + version})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, version, resp.Header.Get(HeaderETag))
+	resp = request(http.MethodGet, map[string]string{HeaderRange: "0-10", HeaderIfMatch: `"other"`})
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp = request(http.MethodPatch, map[string]string{HeaderRange: "0-1", HeaderIfMatch: `"other"`})
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+}
+
+// statusRecorder records the status code written to the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// endSeekCounter counts the seeks to the end of a truncatable handle without Stat, with which its size is found
+type endSeekCounter struct {
+	io.ReadWriteSeeker
+	endSeeks int64
+}
+
+func (c *endSeekCounter) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekEnd {
+		atomic.AddInt64(&c.endSeeks, 1)
+	}
+	return c.ReadWriteSeeker.Seek(offset, whence)
+}
+
+func (c *endSeekCounter) Truncate(size int64) error {
+	return c.ReadWriteSeeker.(*os.File).Truncate(size)
+}
+
+func TestFileVersionCached(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	dst, err := os.CreateTemp(os.TempDir(), "version-cache-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+	_, err = dst.Write([]byte("hello world"))
+	assert.NoError(t, err)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	handle := &endSeekCounter{ReadWriteSeeker: dst}
+	err = srv.ServeFile(context.Background(), fileID, handle)
+	assert.NoError(t, err)
+
+	read := func() string {
+		rdr := NewReader(context.Background(), testServer.URL+prefix, secret, fileID)
+		_, err := rdr.ReadAt(make([]byte, 5), 0)
+		assert.NoError(t, err)
+		return rdr.Version()
+	}
+
+	// The synthesized information of the handle is only sought once for its version
+	version := read()
+	seeks := atomic.LoadInt64(&handle.endSeeks)
+	assert.Equal(t, version, read())
+	assert.Equal(t, version, read())
+	assert.Equal(t, seeks, atomic.LoadInt64(&handle.endSeeks))
+
+	// Writing through the server changes the version
+	_, err = NewWriter(context.Background(), testServer.URL+prefix, secret, fileID).WriteAt([]byte("HELLO"), 0)
+	assert.NoError(t, err)
+	assert.NotEqual(t, version, read())
+
+	version = read()
+	err = NewWriter(context.Background(), testServer.URL+prefix, secret, fileID).Truncate(5)
+	assert.NoError(t, err)
+	assert.NotEqual(t, version, read())
+}
@@ -5,89 +5,243 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log/slog"
+	"io"
 	"net/http"
+	"os"
+	"sync"
 )
 
 // Writer is a byte writer for a remote io.Writer served by a FileServer
 type Writer struct {
 	file
+	buffer      *writeBuffer
+	chunkSize   int // Writes larger than this are split into multiple requests, 0 disables splitting
+	syncOnClose bool
+	pipeline    *writePipeline
+	acked       byteRanges // Ranges the server acknowledged as written
+	ackBase     int64      // Offset of the first write, from which AckedOffset counts
+	ackBaseSet  bool
+	ackMu       sync.Mutex
 }
 
 // NewWriter creates a new remote Writer for the given URL, shared secret and FileID
 func NewWriter(ctx context.Context, baseURL, sharedSecret string, fileID FileID) *Writer {
-	return &Writer{
-		file: file{
-			client:       http.DefaultClient,
-			ctx:          ctx,
-			baseURL:      baseURL,
-			sharedSecret: sharedSecret,
-			fileID:       fileID,
-			offset:       0,
-			logger:       slog.Default(),
-		},
-	}
+	return NewClient(baseURL, WithSharedSecret(sharedSecret)).OpenWriter(ctx, fileID)
 }
 
 // NewCustomClientWriter creates a new remote Writer for the given HTTP file, URL, shared secret and FileID
 func NewCustomClientWriter(ctx context.Context, httpClient *http.Client, baseURL, sharedSecret string, fileID FileID) *Writer {
-	return &Writer{
-		file: file{
-			client:       httpClient,
-			ctx:          ctx,
-			baseURL:      baseURL,
-			sharedSecret: sharedSecret,
-			fileID:       fileID,
-			offset:       0,
-			logger:       slog.Default(),
-		},
-	}
+	return NewClient(baseURL, WithHTTPClient(httpClient), WithSharedSecret(sharedSecret)).OpenWriter(ctx, fileID)
 }
 
-// PutURL returns the URL at which the file can be PUT in a single request
+// PutURL returns the URL at which the file can be PUT in a single request.
+// The URL contains the shared secret, use SignedPutURL to hand out a URL that expires and only grants access to this file.
 func (w *Writer) PutURL() string {
 	return fmt.Sprintf("%s/%s?%s=%s", w.baseURL, w.fileID, GETSharedSecret, w.sharedSecret)
 }
 
+// EnableWriteBuffer enables coalescing of writes in a local buffer. Adjacent and overlapping
+// writes are merged and only sent to the remote file once threshold bytes are buffered,
+// or when Flush or Close is called.
+// It should be called before the writer is used.
+func (w *Writer) EnableWriteBuffer(threshold int) {
+	w.buffer = newWriteBuffer(w, threshold)
+}
+
+// EnablePipelining lets the writer keep up to window write requests in flight, instead of waiting
+// for each write to be acknowledged before starting the next one. Errors of in-flight writes are
+// returned by the next Write, WriteAt, Flush or Close call.
+// It should be called before the writer is used.
+func (w *Writer) EnablePipelining(window int) {
+	w.pipeline = newWritePipeline(w, window)
+}
+
+// AckedOffset returns the highest offset up to which the server acknowledged all writes,
+// counting contiguously from the offset of the first write.
+func (w *Writer) AckedOffset() int64 {
+	w.ackMu.Lock()
+	defer w.ackMu.Unlock()
+	if !w.ackBaseSet {
+		return w.offset
+	}
+	return w.acked.contiguousEnd(w.ackBase)
+}
+
 // Write writes to the remote file
 func (w *Writer) Write(buf []byte) (n int, err error) {
-	n, err = w.write(buf, w.offset)
+	n, err = w.writeAt(buf, w.offset)
 	w.offset += int64(n)
 	return n, err
 }
 
 // WriteAt writes to the remote file at a given offset
 func (w *Writer) WriteAt(buf []byte, offset int64) (n int, err error) {
-	return w.write(buf, offset)
+	return w.writeAt(buf, offset)
 }
 
-func (w *Writer) write(buf []byte, offset int64) (n int, err error) {
+// Flush sends all buffered writes to the remote file and waits for in-flight writes to be acknowledged
+func (w *Writer) Flush() error {
+	if w.buffer != nil {
+		err := w.buffer.flush()
+		if err != nil {
+			return err
+		}
+	}
+	if w.pipeline != nil {
+		return w.pipeline.wait()
+	}
+	return nil
+}
+
+// Seek seeks to the given offset from the given mode, flushing buffered writes first when seeking from the end
+func (w *Writer) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekEnd {
+		err := w.Flush()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return w.file.Seek(offset, whence)
+}
+
+// Stat flushes buffered writes and returns the remote file information
+func (w *Writer) Stat() (os.FileInfo, error) {
+	err := w.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return w.file.Stat()
+}
+
+// Close flushes buffered writes and tells the server to close the remote file
+func (w *Writer) Close() error {
+	err := w.Flush()
+	if err != nil {
+		w.logger.Info("networkfile.Writer.Close: Error flushing buffered writes", "fileID", w.fileID, "error", err)
+		return err
+	}
+	if w.syncOnClose {
+		err = w.operate(OperationSync, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return w.close()
+}
+
+// writeAt writes to the buffer if it is enabled, or sends the write otherwise
+func (w *Writer) writeAt(buf []byte, offset int64) (n int, err error) {
+	if w.buffer != nil {
+		return w.buffer.writeAt(buf, offset)
+	}
+	return w.send(buf, offset)
+}
+
+// send writes to the remote file through the pipeline if it is enabled, or directly otherwise
+func (w *Writer) send(buf []byte, offset int64) (n int, err error) {
+	w.ackMu.Lock()
+	if !w.ackBaseSet {
+		w.ackBase = offset
+		w.ackBaseSet = true
+	}
+	w.ackMu.Unlock()
+
+	for w.chunkSize > 0 && len(buf) > w.chunkSize {
+		sent, err := w.sendChunk(buf[:w.chunkSize], offset)
+		n += sent
+		if err != nil {
+			return n, err
+		}
+		buf = buf[w.chunkSize:]
+		offset += int64(w.chunkSize)
+	}
+	sent, err := w.sendChunk(buf, offset)
+	return n + sent, err
+}
+
+// sendChunk writes a single chunk through the pipeline if it is enabled, or directly otherwise
+func (w *Writer) sendChunk(buf []byte, offset int64) (n int, err error) {
+	if w.pipeline != nil {
+		return w.pipeline.send(buf, offset)
+	}
+	return w.sendNow(buf, offset)
+}
+
+// sendNow writes to the remote file and records the acknowledged range
+func (w *Writer) sendNow(buf []byte, offset int64) (n int, err error) {
+	n, _, err = w.sendContext(w.ctx, buf, offset)
+	return n, err
+}
+
+// sendContext writes to the remote file with a request bound to the given context, records the acknowledged
+// range and returns the version of the remote file the server reported for the write
+func (w *Writer) sendContext(ctx context.Context, buf []byte, offset int64) (n int, version string, err error) {
+	done := w.observe(OperationWrite)
+	n, version, err = w.write(ctx, buf, offset)
+	done(int64(n), err)
+	if n > 0 {
+		w.ackMu.Lock()
+		w.acked.add(offset, offset+int64(n))
+		w.ackMu.Unlock()
+	}
+	return n, version, err
+}
+
+func (w *Writer) write(ctx context.Context, buf []byte, offset int64) (n int, version string, err error) {
 	url := fmt.Sprintf("%s/%s", w.baseURL, w.fileID)
 
-	req, err := w.prepareRequest(http.MethodPatch, url, bytes.NewReader(buf)) // nolint:noctx
+	body := buf
+	compressed := w.compression && w.gzipAccepted.Load()
+	if compressed {
+		body, err = compressGzip(buf)
+		if err != nil {
+			w.logger.Error("networkfile.Writer.write: Error compressing body", "fileID", w.fileID, "error", err)
+			return 0, "", err
+		}
+	}
+
+	req, err := w.prepareRequestContext(ctx, http.MethodPatch, url, bytes.NewReader(body))
 	if err != nil {
 		w.logger.Error("networkfile.Writer.write: Error creating request", "fileID", w.fileID, "error", err)
-		return 0, err
+		return 0, "", err
 	}
 	req.Header.Set(HeaderRange, fmt.Sprintf("%d-%d", offset, len(buf)))
+	if compressed {
+		req.Header.Set(HeaderContentEncoding, EncodingGzip)
+	}
+	if w.digest != "" {
+		h, ok := w.digest.newHash()
+		if !ok {
+			w.logger.Error("networkfile.Writer.write: Unsupported digest algorithm", "fileID", w.fileID, "algorithm", w.digest)
+			return 0, "", ErrUnsupportedOperation
+		}
+		_, _ = h.Write(buf)
+		req.Header.Set(HeaderDigest, formatDigest(w.digest, h.Sum(nil)))
+	}
 
-	resp, err := w.client.Do(req)
+	resp, err := w.do(OperationWrite, req)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
 			w.logger.Info("networkfile.Writer.write: Context expired", "fileID", w.fileID, "logger", err)
 		} else {
 			w.logger.Error("networkfile.Writer.write: Error executing request", "fileID", w.fileID, "error", err)
 		}
-		return 0, err
+		return 0, "", err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 
+	if compressed && resp.StatusCode == http.StatusUnsupportedMediaType {
+		w.logger.Debug("networkfile.Writer.write: Server refused compressed body, sending uncompressed", "fileID", w.fileID)
+		w.gzipAccepted.Store(false)
+		return w.write(ctx, buf, offset)
+	}
+
 	err = responseCodeToError(resp, http.StatusNoContent)
 	if err != nil {
 		w.logger.Info("networkfile.Writer.write: A remote error occurred", "fileID", w.fileID, "error", err)
-		return 0, err
+		return 0, "", err
 	}
 
 	var servOffset, servLength int64
@@ -95,21 +249,33 @@ func (w *Writer) write(buf []byte, offset int64) (n int, err error) {
 	if err != nil || matches != 2 {
 		w.logger.Error("networkfile.Writer.write: Error parsing range header",
 			"range", resp.Header.Get(HeaderRange), "fileID", w.fileID, "error", err)
-		return 0, err
+		return 0, "", err
 	}
 
 	if servOffset != offset {
 		w.logger.Error("networkfile.Writer.write: Server returned unexpected offset",
 			"offset", offset, "serverOffset", servOffset, "fileID", w.fileID)
-		return 0, errors.New("unexpected server offset")
+		return 0, "", errors.New("unexpected server offset")
 	}
 
 	if servLength != int64(len(buf)) {
 		w.logger.Error("networkfile.Writer.write: Server returned unexpected length",
 			"length", len(buf), "serverLength", servLength, "fileID", w.fileID)
-		return 0, errors.New("unexpected server length")
+		return 0, "", errors.New("unexpected server length")
+	}
+
+	if w.digest != "" {
+		echoed := resp.Header.Get(HeaderDigest)
+		if echoed == "" {
+			w.logger.Error("networkfile.Writer.write: Server did not verify the digest", "fileID", w.fileID)
+			return 0, "", ErrDigestMissing
+		} else if echoed != req.Header.Get(HeaderDigest) {
+			w.logger.Error("networkfile.Writer.write: Server verified a different digest",
+				"digest", req.Header.Get(HeaderDigest), "serverDigest", echoed, "fileID", w.fileID)
+			return 0, "", ErrChecksumMismatch
+		}
 	}
 
 	w.logger.Debug("networkfile.Writer.write: Wrote bytes", "length", len(buf), "offset", offset, "fileID", w.fileID)
-	return int(servLength), nil
+	return int(servLength), resp.Header.Get(HeaderETag), nil
 }
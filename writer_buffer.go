@@ -0,0 +1,116 @@
+package networkfile
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultWriteBufferSize is the buffer threshold used when none is configured
+const DefaultWriteBufferSize = 1024 * 1024
+
+// writeExtent is a dirty range of buffered data that has not been sent yet
+type writeExtent struct {
+	offset int64
+	data   []byte
+}
+
+// end returns the offset directly after the extent
+func (e *writeExtent) end() int64 {
+	return e.offset + int64(len(e.data))
+}
+
+// writeBuffer coalesces writes into dirty extents until they are flushed to the remote file
+type writeBuffer struct {
+	wrtr      *Writer
+	threshold int
+	extents   []*writeExtent // Sorted by offset, never overlapping or adjacent
+	size      int
+	mu        sync.Mutex
+}
+
+func newWriteBuffer(wrtr *Writer, threshold int) *writeBuffer {
+	if threshold <= 0 {
+		threshold = DefaultWriteBufferSize
+	}
+	return &writeBuffer{
+		wrtr:      wrtr,
+		threshold: threshold,
+	}
+}
+
+// writeAt buffers the data at the given offset and flushes once the threshold is reached.
+// When flushing fails the data remains buffered and the error is returned.
+func (b *writeBuffer) writeAt(buf []byte, offset int64) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.merge(buf, offset)
+	if b.size < b.threshold {
+		return len(buf), nil
+	}
+	return len(buf), b.flushLocked()
+}
+
+// merge adds the data to the extents, overwriting any overlapping buffered data, assumes the lock is held
+func (b *writeBuffer) merge(buf []byte, offset int64) {
+	end := offset + int64(len(buf))
+
+	// Find all extents that overlap with or are adjacent to the new data
+	first := sort.Search(len(b.extents), func(i int) bool {
+		return b.extents[i].end() >= offset
+	})
+	last := first
+	for last < len(b.extents) && b.extents[last].offset <= end {
+		last++
+	}
+
+	merged := &writeExtent{
+		offset: offset,
+	}
+	mergedEnd := end
+	if first < last {
+		merged.offset = min(offset, b.extents[first].offset)
+		mergedEnd = max(end, b.extents[last-1].end())
+	}
+	merged.data = make([]byte, mergedEnd-merged.offset)
+
+	for _, ext := range b.extents[first:last] {
+		copy(merged.data[ext.offset-merged.offset:], ext.data)
+		b.size -= len(ext.data)
+	}
+	copy(merged.data[offset-merged.offset:], buf)
+	b.size += len(merged.data)
+
+	extents := make([]*writeExtent, 0, len(b.extents)-(last-first)+1)
+	extents = append(extents, b.extents[:first]...)
+	extents = append(extents, merged)
+	extents = append(extents, b.extents[last:]...)
+	b.extents = extents
+}
+
+// flush sends all buffered extents to the remote file
+func (b *writeBuffer) flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked()
+}
+
+// flushLocked sends all buffered extents to the remote file, assumes the lock is held
+func (b *writeBuffer) flushLocked() error {
+	for len(b.extents) > 0 {
+		ext := b.extents[0]
+		n, err := b.wrtr.send(ext.data, ext.offset)
+		b.size -= n
+		ext.offset += int64(n)
+		ext.data = ext.data[n:]
+		if err != nil {
+			return err
+		}
+		b.extents = b.extents[1:]
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package networkfile
+
+import (
+	"sync"
+)
+
+// writePipeline sends writes asynchronously while keeping a limited amount of requests in flight
+type writePipeline struct {
+	wrtr   *Writer
+	window chan struct{}
+	wg     sync.WaitGroup
+	err    error // The first error returned by an in-flight write
+	mu     sync.Mutex
+}
+
+func newWritePipeline(wrtr *Writer, window int) *writePipeline {
+	if window < 1 {
+		window = 1
+	}
+	return &writePipeline{
+		wrtr:   wrtr,
+		window: make(chan struct{}, window),
+	}
+}
+
+// send starts writing a copy of the buffer at the given offset once there is room in the window.
+// It returns the error of an earlier failed write, if any.
+func (p *writePipeline) send(buf []byte, offset int64) (int, error) {
+	err := p.error()
+	if err != nil {
+		return 0, err
+	}
+
+	data := make([]byte, len(buf))
+	copy(data, buf)
+
+	p.window <- struct{}{}
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.window
+			p.wg.Done()
+		}()
+
+		_, err := p.wrtr.sendNow(data, offset)
+		if err != nil {
+			p.mu.Lock()
+			if p.err == nil {
+				p.err = err
+			}
+			p.mu.Unlock()
+		}
+	}()
+	return len(buf), nil
+}
+
+// wait waits for all in-flight writes to finish and returns the first error that occurred
+func (p *writePipeline) wait() error {
+	p.wg.Wait()
+	return p.error()
+}
+
+// error returns the first error that occurred in the pipeline
+func (p *writePipeline) error() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
@@ -0,0 +1,115 @@
+package networkfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// OpenEndedLength is used as the length in the range header of a write request streaming a body of unknown length
+const OpenEndedLength = "*"
+
+// ReadFrom streams the reader into the remote file at the current offset using a single request, until EOF.
+// It returns the amount of bytes the server reports as written, also when the stream was interrupted.
+// When no response is received at all, for example because the connection dropped, it is unknown how much
+// was written and 0 is returned along with the error.
+// Writers with a write buffer, chunk size, pipelining, checksums or compression copy with chunked writes
+// instead, so those keep being used.
+func (w *Writer) ReadFrom(src io.Reader) (n int64, err error) {
+	if w.buffer != nil || w.chunkSize > 0 || w.pipeline != nil || w.digest != "" || w.compression {
+		// Hide ReadFrom from io.CopyBuffer, so it writes through Write
+		return io.CopyBuffer(struct{ io.Writer }{w}, src, make([]byte, max(32*1024, w.chunkSize)))
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return 0, err
+	}
+
+	done := w.observe(OperationWrite)
+	defer func() {
+		done(n, err)
+	}()
+
+	url := fmt.Sprintf("%s/%s", w.baseURL, w.fileID)
+	body := &streamSource{src: src}
+	req, err := w.prepareRequest(http.MethodPatch, url, io.NopCloser(body)) // nolint:noctx
+	if err != nil {
+		w.logger.Error("networkfile.Writer.ReadFrom: Error creating request", "fileID", w.fileID, "error", err)
+		return 0, err
+	}
+	req.Header.Set(HeaderRange, fmt.Sprintf("%d-%s", w.offset, OpenEndedLength))
+
+	resp, err := w.do(OperationWrite, req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			w.logger.Info("networkfile.Writer.ReadFrom: Context expired", "fileID", w.fileID, "error", err)
+		} else {
+			w.logger.Error("networkfile.Writer.ReadFrom: Error executing request", "fileID", w.fileID, "error", err)
+		}
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	respErr := responseCodeToError(resp, http.StatusNoContent)
+
+	var servOffset int64
+	matches, err := fmt.Sscanf(resp.Header.Get(HeaderRange), "%d-%d", &servOffset, &n)
+	if err != nil || matches != 2 {
+		w.logger.Error("networkfile.Writer.ReadFrom: Error parsing range header",
+			"range", resp.Header.Get(HeaderRange), "fileID", w.fileID, "error", err)
+		if respErr != nil {
+			return 0, respErr
+		}
+		return 0, fmt.Errorf("invalid range header: %w", err)
+	}
+	if servOffset != w.offset {
+		w.logger.Error("networkfile.Writer.ReadFrom: Server returned unexpected offset",
+			"offset", w.offset, "serverOffset", servOffset, "fileID", w.fileID)
+		return 0, errors.New("unexpected server offset")
+	}
+
+	if n > 0 {
+		w.ackMu.Lock()
+		if !w.ackBaseSet {
+			w.ackBase = w.offset
+			w.ackBaseSet = true
+		}
+		w.acked.add(w.offset, w.offset+n)
+		w.ackMu.Unlock()
+	}
+	w.offset += n
+
+	if respErr != nil {
+		w.logger.Info("networkfile.Writer.ReadFrom: A remote error occurred", "fileID", w.fileID, "committed", n, "error", respErr)
+		return n, respErr
+	}
+	if body.err != nil {
+		w.logger.Info("networkfile.Writer.ReadFrom: Error reading source", "fileID", w.fileID, "committed", n, "error", body.err)
+		return n, body.err
+	}
+
+	w.logger.Debug("networkfile.Writer.ReadFrom: Streamed bytes", "bytes", n, "offset", servOffset, "fileID", w.fileID)
+	return n, nil
+}
+
+// streamSource ends the request body cleanly when the source fails, so the server still
+// reports how much it has written. The error of the source is recorded instead.
+type streamSource struct {
+	src io.Reader
+	err error
+}
+
+// Read reads from the source
+func (s *streamSource) Read(buf []byte) (int, error) {
+	n, err := s.src.Read(buf)
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.err = err
+		return n, io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,79 @@
+package networkfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingReader returns an error once the underlying reader is exhausted
+type failingReader struct {
+	rdr io.Reader
+	err error
+}
+
+func (f *failingReader) Read(buf []byte) (int, error) {
+	n, err := f.rdr.Read(buf)
+	if errors.Is(err, io.EOF) {
+		return n, f.err
+	}
+	return n, err
+}
+
+func TestWriterReadFrom(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "writer-readfrom-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	src, err := randomFile(300_000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	_, err = wrtr.Write(srcBuf[:1000])
+	assert.NoError(t, err)
+
+	// The source fails halfway, the server should report exactly what it persisted
+	sourceErr := errors.New("source failed")
+	n, err := wrtr.ReadFrom(&failingReader{
+		rdr: io.MultiReader(bytes.NewReader(srcBuf[1000:100_000])),
+		err: sourceErr,
+	})
+	assert.Equal(t, sourceErr, err)
+	assert.EqualValues(t, 99_000, n)
+
+	n, err = wrtr.ReadFrom(io.MultiReader(bytes.NewReader(srcBuf[100_000:])))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 200_000, n)
+	assert.EqualValues(t, 300_000, wrtr.AckedOffset())
+
+	_, err = dst.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	dstBuf, err := io.ReadAll(dst)
+	assert.NoError(t, err)
+	assert.EqualValues(t, srcBuf, dstBuf)
+
+	assert.NoError(t, wrtr.Close())
+}
@@ -1,11 +1,15 @@
 package networkfile
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -55,6 +59,65 @@ func TestWriterCopyFile(t *testing.T) {
 	assert.NoError(t, wrtr.Close())
 }
 
+func TestWriterCopyChunked(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	srv.AllowCompression(true)
+	var patches int64
+	testServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPatch {
+			assert.False(t, strings.HasSuffix(req.Header.Get(HeaderRange), "-"+OpenEndedLength))
+			atomic.AddInt64(&patches, 1)
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+
+	src, err := randomFile(10_000)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	for name, configure := range map[string]func(wrtr *Writer){
+		"chunkSize":   func(wrtr *Writer) { wrtr.chunkSize = 1000 },
+		"buffer":      func(wrtr *Writer) { wrtr.EnableWriteBuffer(1000) },
+		"pipelining":  func(wrtr *Writer) { wrtr.EnablePipelining(4) },
+		"checksum":    func(wrtr *Writer) { wrtr.SetChecksum(DigestSHA256) },
+		"compression": func(wrtr *Writer) { wrtr.SetCompression(true) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			fileID, err := RandomFileID()
+			assert.NoError(t, err)
+			dst, err := os.CreateTemp(os.TempDir(), "writer-chunked-test-")
+			assert.NoError(t, err)
+			defer func() {
+				_ = dst.Close()
+				_ = os.Remove(dst.Name())
+			}()
+			err = srv.ServeFileWriter(context.Background(), fileID, dst)
+			assert.NoError(t, err)
+
+			atomic.StoreInt64(&patches, 0)
+			wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+			configure(wrtr)
+			n, err := io.Copy(wrtr, bytes.NewReader(srcBuf))
+			assert.NoError(t, err)
+			assert.EqualValues(t, 10_000, n)
+			assert.NoError(t, wrtr.Close())
+			assert.Positive(t, atomic.LoadInt64(&patches))
+			if name == "chunkSize" {
+				assert.EqualValues(t, 10, atomic.LoadInt64(&patches))
+			}
+
+			dstBuf, err := os.ReadFile(dst.Name())
+			assert.NoError(t, err)
+			assert.Equal(t, srcBuf, dstBuf)
+		})
+	}
+}
+
 func TestWriterCopyFileLargeBuffer(t *testing.T) {
 	srv := NewFileServer(prefix, secret)
 	testServer := httptest.NewServer(srv)
@@ -152,3 +215,126 @@ func TestPutRequest(t *testing.T) {
 
 	assert.NoError(t, wrtr.Close())
 }
+
+func TestWriterBuffered(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	var requests int64
+	testServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPatch {
+			atomic.AddInt64(&requests, 1)
+		}
+		srv.ServeHTTP(resp, req)
+	}))
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "writer-buffer-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	wrtr.EnableWriteBuffer(1000)
+
+	for i := 0; i < 100; i++ {
+		_, err = fmt.Fprintf(wrtr, "line %02d\n", i)
+		assert.NoError(t, err)
+	}
+	assert.EqualValues(t, 0, atomic.LoadInt64(&requests))
+
+	// Out of order overlapping writes beyond the current data
+	_, err = wrtr.WriteAt([]byte("cccc"), 808)
+	assert.NoError(t, err)
+	_, err = wrtr.WriteAt([]byte("aaaa"), 800)
+	assert.NoError(t, err)
+	_, err = wrtr.WriteAt([]byte("bbbbbb"), 803)
+	assert.NoError(t, err)
+
+	assert.NoError(t, wrtr.Flush())
+	assert.EqualValues(t, 1, atomic.LoadInt64(&requests))
+
+	// Exceeding the threshold flushes automatically
+	_, err = wrtr.WriteAt(make([]byte, 1000), 812)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&requests))
+
+	_, err = dst.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	dstBuf, err := io.ReadAll(dst)
+	assert.NoError(t, err)
+	assert.Len(t, dstBuf, 1812)
+	assert.Equal(t, "line 99\naaabbbbbbccc", string(dstBuf[792:812]))
+
+	assert.NoError(t, wrtr.Close())
+}
+
+func TestWriterPipelined(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	fileID, err := RandomFileID()
+	assert.NoError(t, err)
+	dst, err := os.CreateTemp(os.TempDir(), "writer-pipeline-test-")
+	assert.NoError(t, err)
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+
+	err = srv.ServeFileWriter(context.Background(), fileID, dst)
+	assert.NoError(t, err)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, fileID)
+	wrtr.EnablePipelining(8)
+
+	src, err := randomFile(1_234_567)
+	assert.NoError(t, err)
+	defer func() {
+		_ = src.Close()
+		_ = os.Remove(src.Name())
+	}()
+
+	n, err := io.CopyBuffer(wrtr, src, make([]byte, 10_000))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1_234_567, n)
+
+	assert.NoError(t, wrtr.Flush())
+	assert.EqualValues(t, 1_234_567, wrtr.AckedOffset())
+
+	_, err = dst.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	dstBuf, err := io.ReadAll(dst)
+	assert.NoError(t, err)
+
+	_, err = src.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	srcBuf, err := io.ReadAll(src)
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, srcBuf, dstBuf)
+
+	assert.NoError(t, wrtr.Close())
+}
+
+func TestWriterPipelinedError(t *testing.T) {
+	srv := NewFileServer(prefix, secret)
+	testServer := httptest.NewServer(srv)
+
+	wrtr := NewWriter(context.Background(), testServer.URL+prefix, secret, "unknown")
+	wrtr.EnablePipelining(2)
+
+	n, err := wrtr.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, n)
+
+	assert.Equal(t, ErrUnknownFile, wrtr.Flush())
+	assert.EqualValues(t, 0, wrtr.AckedOffset())
+
+	_, err = wrtr.Write([]byte("world"))
+	assert.Equal(t, ErrUnknownFile, err)
+}